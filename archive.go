@@ -0,0 +1,275 @@
+package main
+
+import (
+    "archive/tar"
+    "archive/zip"
+    "compress/gzip"
+    "context"
+    "errors"
+    "fmt"
+    "hash"
+    "io"
+    "os"
+    "path/filepath"
+    "time"
+)
+
+// archiveWriter adds folders and files to a single archive stream. Entries
+// are written in order and never need to be revisited, so the output can be
+// a pipe.
+type archiveWriter interface {
+    addFolder(name string, mtime time.Time) error
+    // addFile starts an entry of exactly size bytes, to be written to the
+    // returned writer before the next entry is added.
+    addFile(name string, size int64, mtime time.Time) (io.Writer, error)
+    Close() error
+}
+
+func validArchive(format string) error {
+    switch format {
+    case "tar", "tar.gz", "zip":
+        return nil
+    }
+    return fmt.Errorf("invalid --archive %q (want tar, tar.gz or zip)", format)
+}
+
+func newArchiveWriter(format string, out io.Writer) archiveWriter {
+    switch format {
+    case "tar.gz":
+        gz := gzip.NewWriter(out)
+        return &tarArchive{tw: tar.NewWriter(gz), gz: gz}
+    case "zip":
+        return &zipArchive{zw: zip.NewWriter(out)}
+    }
+    return &tarArchive{tw: tar.NewWriter(out)}
+}
+
+type tarArchive struct {
+    tw *tar.Writer
+    gz *gzip.Writer // nil for plain tar
+}
+
+func (a *tarArchive) addFolder(name string, mtime time.Time) error {
+    return a.tw.WriteHeader(&tar.Header{
+        Typeflag: tar.TypeDir,
+        Name:     name + "/",
+        Mode:     0755,
+        ModTime:  mtime,
+    })
+}
+
+func (a *tarArchive) addFile(name string, size int64, mtime time.Time) (io.Writer, error) {
+    err := a.tw.WriteHeader(&tar.Header{
+        Typeflag: tar.TypeReg,
+        Name:     name,
+        Size:     size,
+        Mode:     0644,
+        ModTime:  mtime,
+    })
+    return a.tw, err
+}
+
+func (a *tarArchive) Close() error {
+    err := a.tw.Close()
+    if a.gz != nil {
+        if gzErr := a.gz.Close(); err == nil {
+            err = gzErr
+        }
+    }
+    return err
+}
+
+type zipArchive struct {
+    zw *zip.Writer
+}
+
+func (a *zipArchive) addFolder(name string, mtime time.Time) error {
+    h := &zip.FileHeader{Name: name + "/", Method: zip.Store, Modified: mtime}
+    h.SetMode(os.ModeDir | 0755)
+    _, err := a.zw.CreateHeader(h)
+    return err
+}
+
+func (a *zipArchive) addFile(name string, size int64, mtime time.Time) (io.Writer, error) {
+    h := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: mtime}
+    h.SetMode(0644)
+    return a.zw.CreateHeader(h)
+}
+
+func (a *zipArchive) Close() error {
+    return a.zw.Close()
+}
+
+// sequentialWriter lets fetchSegment write into a stream. It only ever
+// writes in order, continuing where a failed attempt stopped, so the offset
+// can be ignored.
+type sequentialWriter struct {
+    w io.Writer
+}
+
+func (s sequentialWriter) WriteAt(p []byte, off int64) (int, error) {
+    return s.w.Write(p)
+}
+
+// downloadArchive streams remote, a file or a whole folder, into one tar,
+// tar.gz or zip archive written to target, or to stdout when target is "-".
+// Nothing is staged on disk, so a failed file cannot be retried once its
+// entry has started; the archive is abandoned instead.
+func downloadArchive(ctx context.Context, remote, target string, opts downloadOptions) error {
+    if err := validArchive(opts.Archive); err != nil {
+        return err
+    }
+    if opts.SkipExisting || opts.IfNewer || opts.IfChanged {
+        return errors.New("--skip-existing, --if-newer and --if-changed do not apply to --archive")
+    }
+    if opts.Segments > 1 {
+        // Entries are written in order, so a file cannot arrive in pieces.
+        return errors.New("--segments does not apply to --archive")
+    }
+    toStdout := target == "-"
+    if toStdout {
+        // Keep stdout for the archive itself.
+        statusOut = os.Stderr
+    }
+
+    item, err := fetchDriveItem(ctx, remote)
+    if err != nil {
+        return err
+    }
+
+    if fi, err := os.Stat(target); !toStdout && err == nil && fi.IsDir() {
+        target = filepath.Join(target, archiveName(item, opts.Archive))
+    }
+
+    var report downloadReport
+    var jobs, folders []downloadJob
+    if item.Folder != nil {
+        filter, err := newPathFilter(opts.Filters, "")
+        if err != nil {
+            return err
+        }
+        if dropped := filterTree(item, "", filter); dropped > 0 {
+            fmt.Fprintf(statusOut, "🚫 Excluded %d paths by filter\n", dropped)
+        }
+        // Entries are named from the folder itself, as a download would
+        // recreate it.
+        jobs, folders = planDownload(item, item.Name, &report)
+    } else {
+        jobs = []downloadJob{{item: *item, local: item.Name}}
+    }
+
+    var totalBytes int64
+    for _, job := range jobs {
+        totalBytes += job.item.Size
+    }
+    for _, s := range report.Skipped {
+        fmt.Fprintln(statusOut, "⏭️ Skipped:", s)
+    }
+    if opts.DryRun {
+        for _, job := range jobs {
+            fmt.Fprintf(statusOut, "🔍 Would archive: %s (%d bytes)\n", filepath.ToSlash(job.local), job.item.Size)
+        }
+        fmt.Fprintf(statusOut, "\n🔍 %d files (%d MB) would be archived\n", len(jobs), totalBytes/1024/1024)
+        return nil
+    }
+
+    var out io.Writer = os.Stdout
+    var file *os.File
+    if !toStdout {
+        if file, err = os.Create(target); err != nil {
+            return err
+        }
+        out = file
+    }
+
+    fmt.Fprintf(statusOut, "📦 Archiving %d files (%d MB) as %s\n", len(jobs), totalBytes/1024/1024, opts.Archive)
+    progress := startProgress(totalBytes, int64(len(jobs)))
+    err = writeArchive(ctx, newArchiveWriter(opts.Archive, out), jobs, folders, progress, opts)
+    progress.stop()
+    if file != nil {
+        if closeErr := file.Close(); err == nil {
+            err = closeErr
+        }
+    }
+
+    if err != nil {
+        if !toStdout {
+            // A truncated archive is worse than none.
+            os.Remove(target)
+        }
+        if ctx.Err() != nil {
+            fmt.Fprintln(statusOut, "⏹️ Interrupted, archive abandoned")
+            return errInterrupted
+        }
+        return err
+    }
+    if !toStdout {
+        fmt.Fprintln(statusOut, "✅ Archive written:", target)
+    }
+    return nil
+}
+
+// writeArchive adds folders, parents first, then the content of every file
+// in jobs, and finishes the archive.
+func writeArchive(ctx context.Context, archive archiveWriter, jobs, folders []downloadJob, progress *transferProgress, opts downloadOptions) error {
+    for _, folder := range folders {
+        if err := archive.addFolder(filepath.ToSlash(folder.local), archiveTime(&folder.item, opts)); err != nil {
+            return err
+        }
+    }
+    for _, job := range jobs {
+        if err := ctx.Err(); err != nil {
+            return err
+        }
+        name := filepath.ToSlash(job.local)
+        if err := archiveFile(ctx, archive, name, &job.item, progress, opts); err != nil {
+            return fmt.Errorf("%s: %w", name, err)
+        }
+        printLine("✅ %s", name)
+        progress.fileDone()
+    }
+    return archive.Close()
+}
+
+// archiveFile streams one file into a new entry, checking it against the
+// remote hash as it goes.
+func archiveFile(ctx context.Context, archive archiveWriter, name string, item *DriveItem, progress *transferProgress, opts downloadOptions) error {
+    w, err := archive.addFile(name, item.Size, archiveTime(item, opts))
+    if err != nil {
+        return err
+    }
+
+    var h hash.Hash
+    algo := ""
+    if opts.Verify == "hash" {
+        if algo = verifyAlgorithm(*item); algo != "" {
+            h, _ = newHasher(algo)
+            w = io.MultiWriter(w, h)
+        }
+    }
+    if item.Size > 0 {
+        if _, err := fetchSegment(ctx, item, sequentialWriter{w}, 0, item.Size-1, progress); err != nil {
+            return err
+        }
+    }
+
+    sum := ""
+    if h != nil {
+        sum = encodeHash(algo, h.Sum(nil))
+    }
+    return checkTransfer(*item, item.Size, algo, sum, opts.Verify)
+}
+
+// archiveTime is the modified time recorded for item's entry.
+func archiveTime(item *DriveItem, opts downloadOptions) time.Time {
+    mtime := item.modTime()
+    if opts.NoTimes || mtime.IsZero() {
+        return time.Now()
+    }
+    return mtime
+}
+
+// archiveName names the archive written into a target directory.
+func archiveName(item *DriveItem, format string) string {
+    return item.Name + "." + format
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+    "archive/tar"
+    "archive/zip"
+    "bytes"
+    "compress/gzip"
+    "context"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+)
+
+type archiveEntry struct {
+    name  string
+    dir   bool
+    data  string
+    mtime time.Time
+}
+
+var archiveEntries = []archiveEntry{
+    {name: "Project", dir: true, mtime: time.Date(2023, 1, 2, 3, 4, 6, 0, time.UTC)},
+    {name: "Project/sub", dir: true, mtime: time.Date(2023, 2, 3, 4, 5, 6, 0, time.UTC)},
+    {name: "Project/a.txt", data: "hello", mtime: time.Date(2022, 12, 31, 23, 59, 58, 0, time.UTC)},
+    {name: "Project/sub/empty", data: "", mtime: time.Date(2021, 6, 7, 8, 9, 10, 0, time.UTC)},
+    {name: "Project/sub/b.bin", data: strings.Repeat("0123456789", 10000), mtime: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)},
+}
+
+func writeTestArchive(t *testing.T, format string) []byte {
+    var buf bytes.Buffer
+    a := newArchiveWriter(format, &buf)
+    for _, e := range archiveEntries {
+        if e.dir {
+            if err := a.addFolder(e.name, e.mtime); err != nil {
+                t.Fatal(err)
+            }
+            continue
+        }
+        w, err := a.addFile(e.name, int64(len(e.data)), e.mtime)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if _, err := io.Copy(w, strings.NewReader(e.data)); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if err := a.Close(); err != nil {
+        t.Fatal(err)
+    }
+    return buf.Bytes()
+}
+
+// readTestArchive lists the entries of a tar, tar.gz or zip archive.
+func readTestArchive(t *testing.T, format string, data []byte) []archiveEntry {
+    var got []archiveEntry
+    if format == "zip" {
+        zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+        if err != nil {
+            t.Fatal(err)
+        }
+        for _, f := range zr.File {
+            rc, err := f.Open()
+            if err != nil {
+                t.Fatal(err)
+            }
+            b, _ := io.ReadAll(rc)
+            rc.Close()
+            got = append(got, archiveEntry{
+                name:  strings.TrimSuffix(f.Name, "/"),
+                dir:   f.FileInfo().IsDir(),
+                data:  string(b),
+                mtime: f.Modified,
+            })
+        }
+        return got
+    }
+
+    var r io.Reader = bytes.NewReader(data)
+    if format == "tar.gz" {
+        gz, err := gzip.NewReader(r)
+        if err != nil {
+            t.Fatal(err)
+        }
+        r = gz
+    }
+    tr := tar.NewReader(r)
+    for {
+        h, err := tr.Next()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            t.Fatal(err)
+        }
+        b, _ := io.ReadAll(tr)
+        got = append(got, archiveEntry{
+            name:  strings.TrimSuffix(h.Name, "/"),
+            dir:   h.Typeflag == tar.TypeDir,
+            data:  string(b),
+            mtime: h.ModTime,
+        })
+    }
+    return got
+}
+
+func checkArchiveEntries(t *testing.T, format string, got, want []archiveEntry) {
+    t.Helper()
+    if len(got) != len(want) {
+        t.Fatalf("%s: %d entries, want %d", format, len(got), len(want))
+    }
+    for i, w := range want {
+        g := got[i]
+        if g.name != w.name || g.dir != w.dir {
+            t.Errorf("%s: entry %d is %q (dir %v), want %q (dir %v)", format, i, g.name, g.dir, w.name, w.dir)
+        }
+        if len(g.data) != len(w.data) || g.data != w.data {
+            t.Errorf("%s: %s has %d bytes, want %d", format, w.name, len(g.data), len(w.data))
+        }
+        if !g.mtime.Equal(w.mtime) {
+            t.Errorf("%s: %s modified %s, want %s", format, w.name, g.mtime, w.mtime)
+        }
+    }
+}
+
+func TestArchiveWriter(t *testing.T) {
+    for _, format := range []string{"tar", "tar.gz", "zip"} {
+        data := writeTestArchive(t, format)
+        checkArchiveEntries(t, format, readTestArchive(t, format, data), archiveEntries)
+    }
+}
+
+// writeArchive fetches file content over HTTP; a connection that drops
+// mid-file is resumed with a range request into the same entry.
+func TestWriteArchive(t *testing.T) {
+    content := map[string]string{}
+    var folders, jobs []downloadJob
+    for _, e := range archiveEntries {
+        item := DriveItem{Name: e.name, LastModifiedDateTime: e.mtime}
+        if e.dir {
+            folders = append(folders, downloadJob{item: item, local: e.name})
+            continue
+        }
+        item.File = &FileFacet{}
+        item.Size = int64(len(e.data))
+        content["/"+e.name] = e.data
+        jobs = append(jobs, downloadJob{item: item, local: e.name})
+    }
+
+    dropped := false
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        data := content[r.URL.Path]
+        if !dropped && len(data) > 1000 {
+            // Promise the whole file, send part of it and hang up.
+            dropped = true
+            w.Header().Set("Content-Length", "100000")
+            io.WriteString(w, data[:1000])
+            w.(http.Flusher).Flush()
+            panic(http.ErrAbortHandler)
+        }
+        http.ServeContent(w, r, "", time.Time{}, strings.NewReader(data))
+    }))
+    defer srv.Close()
+    for i := range jobs {
+        jobs[i].item.DownloadURL = srv.URL + "/" + jobs[i].local
+    }
+
+    for _, format := range []string{"tar", "zip"} {
+        dropped = false
+        var buf bytes.Buffer
+        progress := startProgress(0, int64(len(jobs)))
+        err := writeArchive(context.Background(), newArchiveWriter(format, &buf), jobs, folders, progress, downloadOptions{Verify: "size"})
+        progress.stop()
+        if err != nil {
+            t.Fatalf("%s: %v", format, err)
+        }
+        if !dropped {
+            t.Fatalf("%s: the connection was never dropped", format)
+        }
+        checkArchiveEntries(t, format, readTestArchive(t, format, buf.Bytes()), archiveEntries)
+    }
+}
+
+func TestDownloadArchiveOptions(t *testing.T) {
+    tests := []downloadOptions{
+        {Archive: "rar"},
+        {Archive: "zip", Segments: 4},
+        {Archive: "tar", IfChanged: true},
+    }
+    for _, opts := range tests {
+        if err := downloadArchive(context.Background(), "/x", "-", opts); err == nil {
+            t.Errorf("downloadArchive accepted %+v", opts)
+        }
+    }
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+    "fmt"
+    "io"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+// bwLimiter caps the combined rate of every transfer in the process. nil
+// means unlimited; main sets it from --bwlimit.
+var bwLimiter *rateLimiter
+
+// bwSlot is one entry of a --bwlimit schedule: from start (time since
+// midnight) onwards the limit is rate bytes per second, 0 meaning no limit.
+type bwSlot struct {
+    start time.Duration
+    rate  int64
+}
+
+// rateLimiter is a token bucket holding up to one second of tokens. A
+// caller may take more than the bucket holds; it then sleeps off the debt,
+// which also holds back everyone after it.
+type rateLimiter struct {
+    mu       sync.Mutex
+    schedule []bwSlot
+    tokens   float64
+    last     time.Time
+}
+
+// setBwLimit installs the process-wide limiter described by spec.
+func setBwLimit(spec string) error {
+    l, err := parseBwLimit(spec)
+    if err != nil {
+        return err
+    }
+    bwLimiter = l
+    return nil
+}
+
+// parseBwLimit parses "5M", or a schedule such as "08:00,2M 18:00,off"
+// whose last entry carries over past midnight.
+func parseBwLimit(spec string) (*rateLimiter, error) {
+    spec = strings.TrimSpace(spec)
+    if spec == "" {
+        return nil, nil
+    }
+    if !strings.Contains(spec, ",") {
+        rate, err := parseRate(spec)
+        if err != nil {
+            return nil, err
+        }
+        return &rateLimiter{schedule: []bwSlot{{rate: rate}}}, nil
+    }
+
+    var schedule []bwSlot
+    for _, field := range strings.Fields(spec) {
+        at, rateSpec, ok := strings.Cut(field, ",")
+        if !ok {
+            return nil, fmt.Errorf("invalid --bwlimit entry %q (want HH:MM,rate)", field)
+        }
+        t, err := time.Parse("15:04", at)
+        if err != nil {
+            return nil, fmt.Errorf("invalid --bwlimit time %q (want HH:MM)", at)
+        }
+        rate, err := parseRate(rateSpec)
+        if err != nil {
+            return nil, err
+        }
+        start := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+        schedule = append(schedule, bwSlot{start: start, rate: rate})
+    }
+    sort.Slice(schedule, func(i, j int) bool { return schedule[i].start < schedule[j].start })
+    return &rateLimiter{schedule: schedule}, nil
+}
+
+// parseRate parses a byte rate per second with an optional K, M or G
+// (binary) suffix. "off" and "0" mean unlimited.
+func parseRate(spec string) (int64, error) {
+    s := strings.ToUpper(strings.TrimSuffix(strings.TrimSpace(spec), "/s"))
+    if s == "OFF" {
+        return 0, nil
+    }
+    multiplier := 1.0
+    switch {
+    case strings.HasSuffix(s, "K"):
+        multiplier = 1 << 10
+    case strings.HasSuffix(s, "M"):
+        multiplier = 1 << 20
+    case strings.HasSuffix(s, "G"):
+        multiplier = 1 << 30
+    }
+    n, err := strconv.ParseFloat(strings.TrimRight(s, "KMG"), 64)
+    if err != nil || n < 0 {
+        return 0, fmt.Errorf("invalid rate %q (want e.g. 512K, 5M or off)", spec)
+    }
+    return int64(n * multiplier), nil
+}
+
+// rate is the limit in force at now.
+func (l *rateLimiter) rate(now time.Time) int64 {
+    since := now.Sub(time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()))
+    // Before the first entry of the day, yesterday's last entry still holds.
+    current := l.schedule[len(l.schedule)-1]
+    for _, slot := range l.schedule {
+        if slot.start > since {
+            break
+        }
+        current = slot
+    }
+    return current.rate
+}
+
+// wait blocks until n more bytes may be transferred.
+func (l *rateLimiter) wait(n int) {
+    if l == nil || n <= 0 {
+        return
+    }
+    l.mu.Lock()
+    now := time.Now()
+    rate := float64(l.rate(now))
+    if rate == 0 {
+        l.tokens, l.last = 0, now
+        l.mu.Unlock()
+        return
+    }
+    if !l.last.IsZero() {
+        l.tokens += now.Sub(l.last).Seconds() * rate
+    }
+    if l.tokens > rate {
+        l.tokens = rate
+    }
+    l.last = now
+    l.tokens -= float64(n)
+    debt := l.tokens
+    l.mu.Unlock()
+
+    if debt < 0 {
+        time.Sleep(time.Duration(-debt / rate * float64(time.Second)))
+    }
+}
+
+// throttledReader paces reads through the shared limiter.
+type throttledReader struct {
+    r io.Reader
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+    // Keep each read small so that concurrent transfers interleave fairly.
+    if len(p) > 64*1024 {
+        p = p[:64*1024]
+    }
+    n, err := t.r.Read(p)
+    bwLimiter.wait(n)
+    return n, err
+}
+
+// throttle wraps r so that reading from it respects --bwlimit.
+func throttle(r io.Reader) io.Reader {
+    if bwLimiter == nil {
+        return r
+    }
+    return &throttledReader{r: r}
+}
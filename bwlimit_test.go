@@ -0,0 +1,116 @@
+package main
+
+import (
+    "testing"
+    "time"
+)
+
+func TestParseRate(t *testing.T) {
+    tests := []struct {
+        in   string
+        want int64
+        err  bool
+    }{
+        {"0", 0, false},
+        {"off", 0, false},
+        {"OFF", 0, false},
+        {"1000", 1000, false},
+        {"512K", 512 << 10, false},
+        {"512k", 512 << 10, false},
+        {"5M", 5 << 20, false},
+        {"1.5M", 3 << 19, false},
+        {"2G", 2 << 30, false},
+        {"5M/s", 5 << 20, false},
+        {" 5M ", 5 << 20, false},
+        {"", 0, true},
+        {"fast", 0, true},
+        {"-1M", 0, true},
+        {"5MB", 0, true},
+    }
+    for _, tt := range tests {
+        got, err := parseRate(tt.in)
+        if (err != nil) != tt.err {
+            t.Errorf("parseRate(%q) error = %v, want error %v", tt.in, err, tt.err)
+            continue
+        }
+        if got != tt.want {
+            t.Errorf("parseRate(%q) = %d, want %d", tt.in, got, tt.want)
+        }
+    }
+}
+
+func TestParseBwLimit(t *testing.T) {
+    tests := []struct {
+        in       string
+        schedule []bwSlot
+        err      bool
+    }{
+        {"", nil, false},
+        {"5M", []bwSlot{{rate: 5 << 20}}, false},
+        {"08:00,2M 18:00,off", []bwSlot{{8 * time.Hour, 2 << 20}, {18 * time.Hour, 0}}, false},
+        // Entries may be given in any order.
+        {"18:00,off 08:30,2M", []bwSlot{{8*time.Hour + 30*time.Minute, 2 << 20}, {18 * time.Hour, 0}}, false},
+        {"08:00,2M 18:00", nil, true},
+        {"8am,2M", nil, true},
+        {"25:00,2M", nil, true},
+        {"08:00,fast", nil, true},
+    }
+    for _, tt := range tests {
+        l, err := parseBwLimit(tt.in)
+        if (err != nil) != tt.err {
+            t.Errorf("parseBwLimit(%q) error = %v, want error %v", tt.in, err, tt.err)
+            continue
+        }
+        if tt.err {
+            continue
+        }
+        if tt.schedule == nil {
+            if l != nil {
+                t.Errorf("parseBwLimit(%q) = %v, want no limit", tt.in, l.schedule)
+            }
+            continue
+        }
+        if len(l.schedule) != len(tt.schedule) {
+            t.Errorf("parseBwLimit(%q) = %v, want %v", tt.in, l.schedule, tt.schedule)
+            continue
+        }
+        for i := range tt.schedule {
+            if l.schedule[i] != tt.schedule[i] {
+                t.Errorf("parseBwLimit(%q) = %v, want %v", tt.in, l.schedule, tt.schedule)
+                break
+            }
+        }
+    }
+}
+
+func TestScheduleRate(t *testing.T) {
+    l, err := parseBwLimit("08:00,2M 18:00,off")
+    if err != nil {
+        t.Fatal(err)
+    }
+    day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.Local)
+    tests := []struct {
+        at   time.Duration
+        want int64
+    }{
+        // Before the first entry, the evening's "off" carries over midnight.
+        {0, 0},
+        {2 * time.Hour, 0},
+        {8*time.Hour - time.Second, 0},
+        {8 * time.Hour, 2 << 20},
+        {12 * time.Hour, 2 << 20},
+        {18*time.Hour - time.Second, 2 << 20},
+        {18 * time.Hour, 0},
+        {23*time.Hour + 59*time.Minute, 0},
+    }
+    for _, tt := range tests {
+        if got := l.rate(day.Add(tt.at)); got != tt.want {
+            t.Errorf("rate at %s = %d, want %d", day.Add(tt.at).Format("15:04:05"), got, tt.want)
+        }
+    }
+
+    single, _ := parseBwLimit("1M")
+    if got := single.rate(day.Add(3 * time.Hour)); got != 1<<20 {
+        t.Errorf("single rate = %d, want %d", got, 1<<20)
+    }
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "io"
+    "net/http"
+    "os"
+    "strconv"
+    "strings"
+)
+
+// Cat streams a remote file to stdout. byteRange is "start-end" or "start-"
+// (inclusive, as in HTTP Range); empty means the whole file. Nothing else is
+// written to stdout so the output can be piped.
+func Cat(ctx context.Context, remote, byteRange string) error {
+    header := ""
+    if byteRange != "" {
+        var err error
+        if header, err = parseByteRange(byteRange); err != nil {
+            return err
+        }
+    }
+
+    item, err := getItem(ctx, remote)
+    if err != nil {
+        return err
+    }
+    if item.File == nil {
+        return fmt.Errorf("%s is not a file", remote)
+    }
+    if item.DownloadURL == "" {
+        return fmt.Errorf("no download URL returned for %s", remote)
+    }
+
+    req, _ := http.NewRequestWithContext(ctx, "GET", item.DownloadURL, nil)
+    if header != "" {
+        req.Header.Set("Range", header)
+    }
+    resp, err := http.DefaultClient.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+
+    switch {
+    case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+        return fmt.Errorf("range %s is outside the file (%d bytes)", byteRange, item.Size)
+    case resp.StatusCode >= 300:
+        return readGraphError(resp)
+    case header != "" && resp.StatusCode != http.StatusPartialContent:
+        return fmt.Errorf("server ignored the requested range")
+    }
+
+    _, err = io.Copy(os.Stdout, resp.Body)
+    return err
+}
+
+func parseByteRange(s string) (string, error) {
+    start, end, ok := strings.Cut(s, "-")
+    if !ok {
+        return "", fmt.Errorf("invalid range %q (want start-end)", s)
+    }
+    from, err := strconv.ParseInt(start, 10, 64)
+    if err != nil || from < 0 {
+        return "", fmt.Errorf("invalid range start %q", start)
+    }
+    if end == "" {
+        return fmt.Sprintf("bytes=%d-", from), nil
+    }
+    to, err := strconv.ParseInt(end, 10, 64)
+    if err != nil || to < from {
+        return "", fmt.Errorf("invalid range end %q", end)
+    }
+    return fmt.Sprintf("bytes=%d-%d", from, to), nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+    "fmt"
+    "path"
+    "strings"
+
+    "golang.org/x/text/unicode/norm"
+)
+
+// collisionKey is how OneDrive tells names apart: without regard to case.
+// Normalizing as well makes NFD names (common in archives made on macOS)
+// compare equal to their NFC spelling.
+func collisionKey(p string) string {
+    return strings.ToLower(norm.NFC.String(p))
+}
+
+func normalizeName(name string) string {
+    return norm.NFC.String(name)
+}
+
+// freeName picks "name (2).ext", "name (3).ext", ... until the result no
+// longer collides with anything in taken.
+func freeName(dir, name string, taken map[string]string) string {
+    ext := path.Ext(name)
+    stem := strings.TrimSuffix(name, ext)
+    for n := 2; ; n++ {
+        candidate := fmt.Sprintf("%s (%d)%s", stem, n, ext)
+        if _, clash := taken[collisionKey(path.Join(dir, candidate))]; !clash {
+            return candidate
+        }
+    }
+}
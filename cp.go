@@ -0,0 +1,145 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/url"
+    "path"
+    "time"
+)
+
+type copyStatus struct {
+    Status             string  `json:"status"`
+    PercentageComplete float64 `json:"percentageComplete"`
+    ResourceID         string  `json:"resourceId"`
+    Error              *struct {
+        Code    string `json:"code"`
+        Message string `json:"message"`
+    } `json:"error,omitempty"`
+}
+
+// monitorClient polls copy monitor URLs. They are pre-authenticated, and on
+// completion may redirect to the new item, which we do not want to follow.
+var monitorClient = &http.Client{
+    CheckRedirect: func(req *http.Request, via []*http.Request) error {
+        return http.ErrUseLastResponse
+    },
+}
+
+// Copy copies items server-side with the /copy action, including into
+// another drive addressed as "<driveId>:/path".
+func Copy(ctx context.Context, sources []string, dst, conflict string) error {
+    if err := validConflict(conflict); err != nil {
+        return err
+    }
+
+    var entries []remoteEntry
+    for _, src := range sources {
+        matched, err := expandRemote(ctx, src)
+        if err != nil {
+            return err
+        }
+        entries = append(entries, matched...)
+    }
+
+    parent, newName, err := resolveDestination(ctx, dst, len(entries) > 1)
+    if err != nil {
+        return err
+    }
+    dstPrefix, _ := splitDrive(dst)
+    dstDrive := driveIDOf(*parent)
+    if dstDrive == "" {
+        dstDrive = dstPrefix
+    }
+
+    failed := 0
+    for _, entry := range entries {
+        name := entry.Item.Name
+        if newName != "" {
+            name = newName
+        }
+        target := joinDrive(dstPrefix, path.Join(remotePathOf(*parent), name))
+        if err := copyItem(ctx, entry, parent.ID, dstDrive, name, conflict); err != nil {
+            fmt.Println("\n❌", entry.Path+":", err)
+            failed++
+            continue
+        }
+        fmt.Printf("\r✅ Copied: %s -> %s\n", entry.Path, target)
+    }
+    if failed > 0 {
+        return fmt.Errorf("%d item(s) could not be copied", failed)
+    }
+    return nil
+}
+
+func copyItem(ctx context.Context, entry remoteEntry, parentID, driveID, name, conflict string) error {
+    ref := map[string]string{"id": parentID}
+    if driveID != "" {
+        ref["driveId"] = driveID
+    }
+    body := map[string]interface{}{
+        "parentReference": ref,
+        "name":            name,
+    }
+
+    endpoint := itemIDURL(entry.Item) + "/copy?@microsoft.graph.conflictBehavior=" + url.QueryEscape(conflict)
+    resp, err := graphDo(ctx, "POST", endpoint, body)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusAccepted {
+        return readGraphError(resp)
+    }
+    monitor := resp.Header.Get("Location")
+    if monitor == "" {
+        return fmt.Errorf("copy accepted but no monitor URL returned")
+    }
+    return waitForCopy(ctx, entry.Path, monitor)
+}
+
+// waitForCopy polls the async operation monitor until the copy finishes.
+func waitForCopy(ctx context.Context, label, monitor string) error {
+    for {
+        req, _ := http.NewRequestWithContext(ctx, "GET", monitor, nil)
+        resp, err := monitorClient.Do(req)
+        if err != nil {
+            return err
+        }
+
+        if resp.StatusCode == http.StatusSeeOther {
+            resp.Body.Close()
+            return nil
+        }
+        if resp.StatusCode >= 300 {
+            err := readGraphError(resp)
+            resp.Body.Close()
+            return err
+        }
+
+        var status copyStatus
+        err = json.NewDecoder(resp.Body).Decode(&status)
+        resp.Body.Close()
+        if err != nil {
+            return err
+        }
+
+        switch status.Status {
+        case "completed":
+            return nil
+        case "failed", "deleteFailed":
+            if status.Error != nil {
+                return fmt.Errorf("copy failed: %s: %s", status.Error.Code, status.Error.Message)
+            }
+            return fmt.Errorf("copy failed")
+        }
+
+        fmt.Printf("\r⏳ Copying %s: %.1f%% (%s)", label, status.PercentageComplete, status.Status)
+        if err := sleepContext(ctx, time.Second); err != nil {
+            return err
+        }
+    }
+}
@@ -0,0 +1,16 @@
+//go:build darwin
+
+package main
+
+import (
+    "os"
+    "syscall"
+    "time"
+)
+
+func fileCreationTime(info os.FileInfo) (time.Time, bool) {
+    if st, ok := info.Sys().(*syscall.Stat_t); ok {
+        return time.Unix(st.Birthtimespec.Unix()), true
+    }
+    return time.Time{}, false
+}
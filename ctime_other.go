@@ -0,0 +1,14 @@
+//go:build !windows && !darwin
+
+package main
+
+import (
+    "os"
+    "time"
+)
+
+// fileCreationTime is unavailable here: os.Stat does not report birth time
+// on Linux and most other Unix systems.
+func fileCreationTime(info os.FileInfo) (time.Time, bool) {
+    return time.Time{}, false
+}
@@ -0,0 +1,16 @@
+//go:build windows
+
+package main
+
+import (
+    "os"
+    "syscall"
+    "time"
+)
+
+func fileCreationTime(info os.FileInfo) (time.Time, bool) {
+    if d, ok := info.Sys().(*syscall.Win32FileAttributeData); ok {
+        return time.Unix(0, d.CreationTime.Nanoseconds()), true
+    }
+    return time.Time{}, false
+}
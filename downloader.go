@@ -2,204 +2,562 @@ package main
 
 import (
     "context"
-    "encoding/json"
+    "errors"
     "fmt"
+    "hash"
     "io"
     "net/http"
     "os"
+    "path"
     "path/filepath"
+    "sort"
     "strings"
-    "sync/atomic"
-    "time"
+    "sync"
 )
 
-func fetchDriveItem(accessToken, remote string) (*DriveItem, error) {
-    var endpoint string
-    if strings.HasPrefix(remote, "/") {
-        endpoint = fmt.Sprintf("https://graph.microsoft.com/v1.0/me/drive/root:%s", remote)
-        if !strings.HasSuffix(remote, "/") {
-            endpoint += ":"
+// fetchDriveItem resolves a remote path or item ID and, for folders, the
+// whole tree below it.
+func fetchDriveItem(ctx context.Context, remote string) (*DriveItem, error) {
+    item, err := getItem(ctx, remote)
+    if err != nil {
+        return nil, err
+    }
+    if item.Folder != nil {
+        if err := fetchChildren(ctx, item); err != nil {
+            return nil, err
         }
-    } else {
-        endpoint = fmt.Sprintf("https://graph.microsoft.com/v1.0/me/drive/items/%s", remote)
     }
+    return item, nil
+}
 
-    req, _ := http.NewRequest("GET", endpoint, nil)
-    req.Header.Set("Authorization", "Bearer "+accessToken)
-    resp, err := http.DefaultClient.Do(req)
+func fetchChildren(ctx context.Context, folder *DriveItem) error {
+    children, err := listChildrenAt(ctx, itemIDURL(*folder) + "/children")
     if err != nil {
-        return nil, err
+        return err
     }
-    defer resp.Body.Close()
-
-    var item DriveItem
-    if err := json.NewDecoder(resp.Body).Decode(&item); err != nil {
-        return nil, err
+    for i := range children {
+        if children[i].Folder != nil {
+            if err := fetchChildren(ctx, &children[i]); err != nil {
+                return err
+            }
+        }
     }
+    folder.Children = children
+    return nil
+}
 
-    if item.Folder != nil {
-        var childrenEndpoint string
-        if strings.HasPrefix(remote, "/") {
-            childrenEndpoint = endpoint + "/children"
-        } else {
-            childrenEndpoint = fmt.Sprintf("https://graph.microsoft.com/v1.0/me/drive/items/%s/children", item.ID)
+// filterTree drops children excluded by filter. rel is the item's path
+// relative to the download root.
+func filterTree(item *DriveItem, rel string, filter *pathFilter) int {
+    dropped := 0
+    kept := item.Children[:0]
+    for _, child := range item.Children {
+        childRel := path.Join(rel, child.Name)
+        if filter.excluded(childRel, child.Folder != nil) {
+            dropped++
+            continue
         }
+        if child.Folder != nil {
+            dropped += filterTree(&child, childRel, filter)
+        }
+        kept = append(kept, child)
+    }
+    item.Children = kept
+    return dropped
+}
+
+// countingReader adds everything read through it to the progress display.
+type countingReader struct {
+    r        io.Reader
+    progress *transferProgress
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+    n, err := c.r.Read(p)
+    c.progress.addBytes(int64(n))
+    return n, err
+}
 
-        req2, _ := http.NewRequest("GET", childrenEndpoint, nil)
-        req2.Header.Set("Authorization", "Bearer "+accessToken)
-        resp2, err := http.DefaultClient.Do(req2)
+// downloadURLMu guards DownloadURL on items being downloaded, which segment
+// workers may refresh concurrently.
+var downloadURLMu sync.Mutex
+
+func currentDownloadURL(item *DriveItem) string {
+    downloadURLMu.Lock()
+    defer downloadURLMu.Unlock()
+    return item.DownloadURL
+}
+
+// getContent requests item's content, optionally a byte range of it. The
+// pre-authenticated downloadUrl captured with the tree expires after about an
+// hour; when it is rejected the item is looked up again by ID for a fresh one.
+func getContent(ctx context.Context, item *DriveItem, byteRange string) (*http.Response, error) {
+    for attempt := 1; ; attempt++ {
+        url := currentDownloadURL(item)
+        req, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
+        if byteRange != "" {
+            req.Header.Set("Range", byteRange)
+        }
+        resp, err := http.DefaultClient.Do(req)
         if err != nil {
             return nil, err
         }
-        defer resp2.Body.Close()
-
-        var childResp struct {
-            Value []DriveItem `json:"value"`
+        expired := resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden
+        if !expired || attempt > 1 {
+            return resp, nil
         }
-        if err := json.NewDecoder(resp2.Body).Decode(&childResp); err != nil {
+        resp.Body.Close()
+        if err := refreshDownloadURL(ctx, item, url); err != nil {
             return nil, err
         }
-        item.Children = childResp.Value
     }
-
-    return &item, nil
 }
 
-func calcTotalSize(item *DriveItem) int64 {
-    if item.File != nil {
-        return item.Size
+// refreshDownloadURL replaces stale with a fresh download URL for item,
+// unless another worker has already done so.
+func refreshDownloadURL(ctx context.Context, item *DriveItem, stale string) error {
+    downloadURLMu.Lock()
+    defer downloadURLMu.Unlock()
+    if item.DownloadURL != stale {
+        return nil
     }
-    total := int64(0)
-    for _, child := range item.Children {
-        total += calcTotalSize(&child)
+
+    var fresh DriveItem
+    if err := graphJSON(ctx, "GET", itemIDURL(*item), nil, &fresh); err != nil {
+        return fmt.Errorf("refreshing download link: %w", err)
+    }
+    if item.ETag != "" && fresh.ETag != item.ETag {
+        // Never mix bytes from two versions; a later run fetches the new one.
+        return &graphError{StatusCode: http.StatusPreconditionFailed, Message: item.Name + " changed on OneDrive during the download"}
+    }
+    if fresh.DownloadURL == "" {
+        return fmt.Errorf("no download URL returned for %s", item.Name)
     }
-    return total
+    printLine("🔄 Download link for %s expired, refreshed", item.Name)
+    item.DownloadURL = fresh.DownloadURL
+    return nil
 }
 
-func downloadFileWithProgress(url, localPath string, downloaded *int64) error {
+// downloadFileWithProgress downloads item to localPath through a .partial
+// file, resuming one left by an earlier attempt, and tries again if the
+// result fails verification.
+func downloadFileWithProgress(ctx context.Context, item *DriveItem, localPath string, progress *transferProgress, opts downloadOptions) error {
     os.MkdirAll(filepath.Dir(localPath), os.ModePerm)
+    partial := localPath + partialSuffix
+    segments := segmentCount(item.Size, opts.Segments)
+    for attempt := 1; ; attempt++ {
+        var n int64
+        var err error
+        if segments > 1 {
+            n, err = downloadSegments(ctx, item, partial, progress, segments, opts.Verify)
+        } else {
+            n, err = downloadOnce(ctx, item, partial, progress, opts.Verify)
+        }
+        if err == nil {
+            forgetPartial(partial)
+            return os.Rename(partial, localPath)
+        }
+        if ctx.Err() != nil {
+            if opts.OnInterrupt == "discard" {
+                discardPartial(partial)
+            }
+            return err
+        }
+        if !isMismatch(err) || attempt == maxVerifyAttempts {
+            return err
+        }
+        progress.addBytes(-n)
+        printLine("⚠️ %s: %v, downloading again", item.Name, err)
+    }
+}
 
-    resp, err := http.Get(url)
-    if err != nil {
-        return err
+// downloadOnce makes one attempt at completing partial, hashing the content
+// when verify is "hash". It returns the bytes added to progress, including
+// any that were already in the file.
+func downloadOnce(ctx context.Context, item *DriveItem, partial string, progress *transferProgress, verify string) (int64, error) {
+    offset := resumeOffset(partial, item)
+
+    var h hash.Hash
+    algo := ""
+    if verify == "hash" {
+        if algo = verifyAlgorithm(*item); algo != "" {
+            h, _ = newHasher(algo)
+        }
     }
-    defer resp.Body.Close()
 
-    out, err := os.Create(localPath)
+    var resp *http.Response
+    if offset < item.Size || item.Size == 0 {
+        byteRange := ""
+        if offset > 0 {
+            byteRange = fmt.Sprintf("bytes=%d-", offset)
+        }
+        var err error
+        if resp, err = getContent(ctx, item, byteRange); err != nil {
+            return 0, err
+        }
+        defer resp.Body.Close()
+
+        switch {
+        case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+            discardPartial(partial)
+            return 0, &mismatchError{fmt.Sprintf("cannot resume at byte %d", offset)}
+        case resp.StatusCode >= 300:
+            return 0, readGraphError(resp)
+        case resp.StatusCode != http.StatusPartialContent:
+            // The server sent the whole file rather than the range.
+            offset = 0
+        }
+    }
+
+    flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+    if offset > 0 {
+        flags = os.O_RDWR | os.O_APPEND
+    }
+    out, err := os.OpenFile(partial, flags, 0644)
     if err != nil {
-        return err
+        return 0, err
     }
-    defer out.Close()
+    rememberPartial(partial, partialDownload{ETag: item.ETag})
 
-    buf := make([]byte, 32*1024)
-    for {
-        n, err := resp.Body.Read(buf)
-        if n > 0 {
-            out.Write(buf[:n])
-            atomic.AddInt64(downloaded, int64(n))
-        }
-        if err != nil {
-            if err == io.EOF {
-                break
+    if offset > 0 {
+        printLine("♻️ Resuming %s at %d/%d MB", item.Name, offset/1024/1024, item.Size/1024/1024)
+        if h != nil {
+            if _, err := io.Copy(h, io.NewSectionReader(out, 0, offset)); err != nil {
+                out.Close()
+                return 0, err
             }
-            return err
         }
+        progress.addBytes(offset)
     }
-    return nil
+
+    var n int64
+    if resp != nil {
+        var w io.Writer = out
+        if h != nil {
+            w = io.MultiWriter(out, h)
+        }
+        n, err = io.Copy(w, &countingReader{r: throttle(resp.Body), progress: progress})
+    }
+    if closeErr := out.Close(); err == nil {
+        err = closeErr
+    }
+    total := offset + n
+    if errors.Is(err, io.ErrUnexpectedEOF) {
+        // The connection closed early. Keep what arrived and resume from it.
+        return total, &mismatchError{fmt.Sprintf("connection closed after %d of %d bytes", total, item.Size)}
+    }
+    if err != nil {
+        return total, err
+    }
+
+    sum := ""
+    if h != nil {
+        sum = encodeHash(algo, h.Sum(nil))
+    }
+    if err := checkTransfer(*item, total, algo, sum, verify); err != nil {
+        // The content is wrong somewhere, so resuming would not help.
+        discardPartial(partial)
+        return total, err
+    }
+    return total, nil
 }
 
+// setLocalTimes gives a downloaded file or folder the remote item's last
+// modified time instead of the time it was written.
+func setLocalTimes(localPath string, item *DriveItem, opts downloadOptions) error {
+    mtime := item.modTime()
+    if opts.NoTimes || mtime.IsZero() {
+        return nil
+    }
+    return os.Chtimes(localPath, mtime, mtime)
+}
 
-func downloadRecursive(accessToken string, item *DriveItem, localPath string, downloaded *int64) error {
-    if item.File != nil {
-        fi, err := os.Stat(localPath)
-        if (err == nil && fi.IsDir()) || strings.HasSuffix(localPath, string(os.PathSeparator)) {
-            localPath = filepath.Join(localPath, item.Name)
-        }
-        fmt.Println("Downloading:", item.Name)
-        return downloadFileWithProgress(item.DownloadURL, localPath, downloaded)
+type downloadOptions struct {
+    NoTimes  bool   // keep the download time instead of the remote modified time
+    Verify   string // off, size or hash: how downloads are checked
+    Segments int    // parallel range requests per large file
+    Workers  int    // files downloaded in parallel within a folder
+
+    OnInterrupt string // keep or discard .partial files when interrupted
+    Filters  filterOptions
+
+    SkipExisting bool // leave files that already exist locally alone
+    IfNewer      bool // only replace local files older than the remote one
+    IfChanged    bool // only replace local files whose size or hash differ
+    DryRun       bool // list what would be downloaded without downloading
+
+    Archive string // tar, tar.gz or zip: stream into one archive instead of files
+}
+
+// skipReason decides whether a remote file should be left alone given what
+// is already at local. An empty reason means download it.
+func (o downloadOptions) skipReason(local string, item *DriveItem) (string, error) {
+    info, err := os.Stat(local)
+    if os.IsNotExist(err) {
+        return "", nil
+    }
+    if err != nil {
+        return "", err
     }
+    if info.IsDir() {
+        return "", fmt.Errorf("%s is a folder", local)
+    }
+    if o.SkipExisting {
+        return "already exists", nil
+    }
+    if o.IfNewer && !item.modTime().After(info.ModTime()) {
+        return "local is not older", nil
+    }
+    return "", nil
+}
 
-    if item.Folder != nil {
-        localFolder := localPath
-        if item.Name != "" {
-            localFolder = filepath.Join(localPath, item.Name)
+// unchanged reports whether --if-changed leaves local alone because it
+// already holds item's content. Hashing is slow on a large tree, so the
+// download workers call this rather than the planning pass.
+func (o downloadOptions) unchanged(local string, item *DriveItem) (bool, error) {
+    if !o.IfChanged {
+        return false, nil
+    }
+    info, err := os.Stat(local)
+    if os.IsNotExist(err) {
+        return false, nil
+    }
+    if err != nil {
+        return false, err
+    }
+    return sameContent(local, info, item)
+}
+
+type downloadJob struct {
+    item  DriveItem
+    local string
+}
+
+// downloadReport collects what happened to each file for the final summary.
+type downloadReport struct {
+    mu         sync.Mutex
+    Downloaded []string
+    Skipped    []string
+    Failed     []string
+}
+
+func (r *downloadReport) add(list *[]string, entry string) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    *list = append(*list, entry)
+}
+
+func (r *downloadReport) print() {
+    fmt.Printf("\n📊 %d downloaded, %d failed, %d skipped\n", len(r.Downloaded), len(r.Failed), len(r.Skipped))
+    sort.Strings(r.Skipped)
+    for _, s := range r.Skipped {
+        fmt.Println("⏭️ Skipped:", s)
+    }
+    if len(r.Failed) > 0 {
+        sort.Strings(r.Failed)
+        fmt.Println("\n❌ Failed downloads:")
+        for _, f := range r.Failed {
+            fmt.Println("  " + f)
         }
-        os.MkdirAll(localFolder, os.ModePerm)
-        for _, child := range item.Children {
-            if err := downloadRecursive(accessToken, &child, localFolder, downloaded); err != nil {
-                return err
-            }
+    }
+}
+
+// planDownload lists the files under folder, to be written below
+// localFolder, and the folders themselves, parents first.
+func planDownload(folder *DriveItem, localFolder string, report *downloadReport) (jobs []downloadJob, folders []downloadJob) {
+    folders = append(folders, downloadJob{item: *folder, local: localFolder})
+    for i := range folder.Children {
+        child := &folder.Children[i]
+        local := filepath.Join(localFolder, child.Name)
+        switch {
+        case child.File != nil:
+            jobs = append(jobs, downloadJob{item: *child, local: local})
+        case child.Folder != nil:
+            childJobs, childFolders := planDownload(child, local, report)
+            jobs = append(jobs, childJobs...)
+            folders = append(folders, childFolders...)
+        default:
+            // Packages such as OneNote notebooks have no content to fetch.
+            report.add(&report.Skipped, local+" (not a file)")
         }
     }
-    return nil
+    return jobs, folders
 }
 
 // StartDownload used by main.go
-func StartDownload(remote, localPath string) error {
-    accessToken := GetAccessToken() // old signature: returns string
-    ctx := context.Background()
-    _ = ctx
+func StartDownload(ctx context.Context, remote, localPath string, opts downloadOptions) error {
+    if err := validVerify(opts.Verify); err != nil {
+        return err
+    }
+    if err := validInterrupt(opts.OnInterrupt); err != nil {
+        return err
+    }
+    if opts.Archive != "" {
+        return downloadArchive(ctx, remote, localPath, opts)
+    }
 
     if localPath == "." {
         cwd, _ := os.Getwd()
         localPath = cwd
     }
 
-    item, err := fetchDriveItem(accessToken, remote)
+    item, err := fetchDriveItem(ctx, remote)
     if err != nil {
         return err
     }
-    
-    fi, statErr := os.Stat(localPath)
-    if statErr == nil && fi.IsDir() && item.Folder != nil {
-        localPath = filepath.Join(localPath, item.Name)
-    } else if os.IsNotExist(statErr) {
-        if item.Folder != nil {
-            os.MkdirAll(localPath, os.ModePerm)
-        } else {
-            os.MkdirAll(filepath.Dir(localPath), os.ModePerm)
-        }
-    }
-
-    totalSize := calcTotalSize(item)
-    var downloaded int64 = 0
-    start := time.Now()
-
-    done := make(chan struct{})
-    go func() {
-        ticker := time.NewTicker(200 * time.Millisecond)
-        defer ticker.Stop()
-        for {
-            select {
-            case <-ticker.C:
-                percent := float64(downloaded) / float64(totalSize) * 100
-                elapsed := time.Since(start).Seconds()
-                speed := float64(downloaded) / 1024 / 1024 / elapsed
-                eta := "-"
-                if speed > 0 {
-                    remaining := float64(totalSize-downloaded) / 1024 / 1024 / speed
-                    eta = fmt.Sprintf("%.1fs", remaining)
+
+    var report downloadReport
+    var jobs, folders []downloadJob
+    if item.Folder != nil {
+        // The folder is recreated inside the destination, like cp -r into
+        // an existing directory.
+        dest := filepath.Join(localPath, item.Name)
+
+        // A .onedriveignore at the root of a local copy applies to pulls
+        // too, with the same paths an upload of that copy would use.
+        filter, err := newPathFilter(opts.Filters, dest)
+        if err != nil {
+            return err
+        }
+        if dropped := filterTree(item, "", filter); dropped > 0 {
+            fmt.Printf("🚫 Excluded %d paths by filter\n", dropped)
+        }
+
+        jobs, folders = planDownload(item, dest, &report)
+    } else {
+        fi, err := os.Stat(localPath)
+        if (err == nil && fi.IsDir()) || strings.HasSuffix(localPath, string(os.PathSeparator)) {
+            localPath = filepath.Join(localPath, item.Name)
+        }
+        jobs = []downloadJob{{item: *item, local: localPath}}
+    }
+
+    planned := len(jobs)
+    var totalBytes int64
+    kept := jobs[:0]
+    for _, job := range jobs {
+        reason, err := opts.skipReason(job.local, &job.item)
+        if err != nil {
+            return err
+        }
+        if reason != "" {
+            report.add(&report.Skipped, fmt.Sprintf("%s (%s)", job.local, reason))
+            continue
+        }
+        kept = append(kept, job)
+        totalBytes += job.item.Size
+    }
+    jobs = kept
+
+    if opts.DryRun {
+        // Nothing is downloaded, so comparing content here in turn is fine.
+        kept := jobs[:0]
+        totalBytes = 0
+        for _, job := range jobs {
+            same, err := opts.unchanged(job.local, &job.item)
+            if err != nil {
+                return err
+            }
+            if same {
+                report.add(&report.Skipped, fmt.Sprintf("%s (unchanged)", job.local))
+                continue
+            }
+            kept = append(kept, job)
+            totalBytes += job.item.Size
+        }
+        jobs = kept
+        for _, job := range jobs {
+            fmt.Printf("🔍 Would download: %s (%d bytes)\n", job.local, job.item.Size)
+        }
+        for _, s := range report.Skipped {
+            fmt.Println("⏭️ Skipped:", s)
+        }
+        fmt.Printf("\n🔍 %d of %d files (%d MB) would be downloaded\n", len(jobs), planned, totalBytes/1024/1024)
+        return nil
+    }
+    for _, folder := range folders {
+        if err := os.MkdirAll(folder.local, os.ModePerm); err != nil {
+            return err
+        }
+    }
+    workers := opts.Workers
+    if workers < 1 {
+        workers = 1
+    }
+    if workers > len(jobs) {
+        workers = len(jobs)
+    }
+    fmt.Printf("📦 Downloading %d files (%d MB) to %s\n", len(jobs), totalBytes/1024/1024, localPath)
+    progress := startProgress(totalBytes, int64(len(jobs)))
+
+    queue := make(chan downloadJob)
+    var wg sync.WaitGroup
+    for w := 0; w < workers; w++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for job := range queue {
+                same, err := opts.unchanged(job.local, &job.item)
+                if err == nil && same {
+                    report.add(&report.Skipped, fmt.Sprintf("%s (unchanged)", job.local))
+                    progress.addBytes(job.item.Size)
+                    progress.fileDone()
+                    continue
+                }
+                if err == nil {
+                    err = downloadFileWithProgress(ctx, &job.item, job.local, progress, opts)
                 }
-                fmt.Printf("\r%.2f%% | %d/%d MB | %.2f MB/s | Elapsed: %.1fs | ETA: %s",
-                    percent,
-                    downloaded/1024/1024, totalSize/1024/1024,
-                    speed,
-                    elapsed,
-                    eta,
-                )
-            case <-done:
-                fmt.Printf("\r100%% | %d/%d MB | Done!\n", totalSize/1024/1024, totalSize/1024/1024)
-                return
+                if err == nil {
+                    err = setLocalTimes(job.local, &job.item, opts)
+                }
+                if err != nil && ctx.Err() != nil {
+                    // Interrupted, not failed; reported below.
+                    continue
+                }
+                if err != nil {
+                    printLine("❌ %s: %v", job.local, err)
+                    report.add(&report.Failed, fmt.Sprintf("%s: %v", job.local, err))
+                } else {
+                    printLine("✅ %s", job.local)
+                    report.add(&report.Downloaded, job.local)
+                }
+                progress.fileDone()
             }
+        }()
+    }
+feed:
+    for _, job := range jobs {
+        select {
+        case queue <- job:
+        case <-ctx.Done():
+            break feed
         }
-    }()
+    }
+    close(queue)
+    wg.Wait()
+    progress.stop()
 
-    fmt.Println("Starting download to:", localPath)
-    if err := downloadRecursive(accessToken, item, localPath, &downloaded); err != nil {
-        return err
+    // Writing the files touched their folders, so stamp those last, deepest
+    // first.
+    for i := len(folders) - 1; i >= 0; i-- {
+        setLocalTimes(folders[i].local, &folders[i].item, opts)
     }
 
-    close(done)
-    fmt.Println("\nDownload complete!")
+    report.print()
+    if ctx.Err() != nil {
+        if opts.OnInterrupt == "keep" {
+            fmt.Println("⏸️ Partial files were kept; run the same download again to resume.")
+            if opts.Segments > 1 {
+                // Segments finish out of order, so their partials have no
+                // single offset to resume from.
+                fmt.Println("   Files being fetched in segments were discarded and will start over.")
+            }
+        }
+        fmt.Printf("⏹️ Interrupted after %d of %d files\n", len(report.Downloaded), len(jobs))
+        return errInterrupted
+    }
+    if len(report.Failed) > 0 {
+        return fmt.Errorf("%d of %d files failed to download", len(report.Failed), len(jobs))
+    }
     return nil
 }
@@ -0,0 +1,31 @@
+package main
+
+import (
+    "os"
+    "path/filepath"
+    "testing"
+)
+
+func TestDownloadUnchanged(t *testing.T) {
+    dir := t.TempDir()
+    local := filepath.Join(dir, "a.txt")
+    if err := os.WriteFile(local, []byte("abc"), 0644); err != nil {
+        t.Fatal(err)
+    }
+    item := &DriveItem{Size: 3, File: &FileFacet{Hashes: &Hashes{QuickXorHash: "YRDDGAAAAAAAAAAAAwAAAAAAAAA="}}}
+
+    opts := downloadOptions{IfChanged: true}
+    // Content is compared by the workers, not while planning.
+    if reason, err := opts.skipReason(local, item); err != nil || reason != "" {
+        t.Errorf("skipReason = %q, %v; want no reason", reason, err)
+    }
+    if same, err := opts.unchanged(local, item); err != nil || !same {
+        t.Errorf("unchanged = %v, %v; want true", same, err)
+    }
+    if same, _ := opts.unchanged(filepath.Join(dir, "missing.txt"), item); same {
+        t.Error("unchanged is true for a missing file")
+    }
+    if same, _ := (downloadOptions{}).unchanged(local, item); same {
+        t.Error("unchanged is true without --if-changed")
+    }
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+    "bufio"
+    "flag"
+    "fmt"
+    "os"
+    "path/filepath"
+    "regexp"
+    "strings"
+)
+
+const IgnoreFile = ".onedriveignore"
+
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (l *stringList) String() string {
+    return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(v string) error {
+    *l = append(*l, v)
+    return nil
+}
+
+type filterOptions struct {
+    Include     stringList
+    Exclude     stringList
+    ExcludeFrom stringList
+}
+
+func (o *filterOptions) register(fs *flag.FlagSet) {
+    fs.Var(&o.Include, "include", "only transfer files matching this glob (repeatable)")
+    fs.Var(&o.Exclude, "exclude", "skip paths matching this glob (repeatable)")
+    fs.Var(&o.ExcludeFrom, "exclude-from", "read exclude patterns from a file (repeatable)")
+}
+
+// ignoreRule is one gitignore-style pattern. base is the slash-separated
+// directory the pattern came from; it only applies below that directory.
+type ignoreRule struct {
+    base    string
+    re      *regexp.Regexp
+    negate  bool
+    dirOnly bool
+}
+
+// pathFilter decides which paths a transfer skips. Exclude rules follow
+// gitignore semantics: the last matching rule wins and "!" re-includes.
+// Rules from the command line are checked after every .onedriveignore rule,
+// so an ignore file can never override them. Include patterns, when given,
+// must match every file (not folders).
+type pathFilter struct {
+    rules    []ignoreRule // from .onedriveignore files
+    cliRules []ignoreRule // from --exclude and --exclude-from
+    includes []ignoreRule
+}
+
+// newPathFilter builds a filter from the command line options and, if root is
+// not empty, the .onedriveignore file in that local directory. Uploads add
+// nested ignore files as they walk the tree; downloads only read the one at
+// the root of the local copy, since the folders below it may not exist yet.
+func newPathFilter(opts filterOptions, root string) (*pathFilter, error) {
+    f := &pathFilter{}
+    if root != "" {
+        if err := f.loadIgnoreFile(filepath.Join(root, IgnoreFile), ""); err != nil {
+            return nil, err
+        }
+    }
+    for _, file := range opts.ExcludeFrom {
+        if _, err := os.Stat(file); err != nil {
+            return nil, err
+        }
+        if err := f.loadRules(file, "", &f.cliRules); err != nil {
+            return nil, err
+        }
+    }
+    for _, p := range opts.Exclude {
+        if err := addRule(&f.cliRules, p, ""); err != nil {
+            return nil, err
+        }
+    }
+    for _, p := range opts.Include {
+        rule, ok, err := parseRule(p, "")
+        if err != nil {
+            return nil, err
+        }
+        if ok {
+            f.includes = append(f.includes, rule)
+        }
+    }
+    return f, nil
+}
+
+// loadIgnoreFile adds the rules in a .onedriveignore file, relative to base.
+// A missing file is not an error, and a nil filter ignores it.
+func (f *pathFilter) loadIgnoreFile(file, base string) error {
+    if f == nil {
+        return nil
+    }
+    return f.loadRules(file, base, &f.rules)
+}
+
+func (f *pathFilter) loadRules(file, base string, rules *[]ignoreRule) error {
+    fh, err := os.Open(file)
+    if os.IsNotExist(err) {
+        return nil
+    }
+    if err != nil {
+        return err
+    }
+    defer fh.Close()
+
+    scanner := bufio.NewScanner(fh)
+    for scanner.Scan() {
+        if err := addRule(rules, scanner.Text(), base); err != nil {
+            return fmt.Errorf("%s: %w", file, err)
+        }
+    }
+    return scanner.Err()
+}
+
+func addRule(rules *[]ignoreRule, pattern, base string) error {
+    rule, ok, err := parseRule(pattern, base)
+    if err != nil || !ok {
+        return err
+    }
+    *rules = append(*rules, rule)
+    return nil
+}
+
+// excluded reports whether rel, a slash-separated path relative to the
+// transfer root, should be skipped. Callers skip the whole subtree of an
+// excluded folder, as git does.
+func (f *pathFilter) excluded(rel string, isDir bool) bool {
+    if f == nil || rel == "." || rel == "" {
+        return false
+    }
+
+    excluded := false
+    for _, rules := range [][]ignoreRule{f.rules, f.cliRules} {
+        for _, r := range rules {
+            if r.matches(rel, isDir) {
+                excluded = !r.negate
+            }
+        }
+    }
+    if excluded || isDir || len(f.includes) == 0 {
+        return excluded
+    }
+
+    for _, r := range f.includes {
+        if r.matches(rel, false) {
+            return false
+        }
+    }
+    return true
+}
+
+func (r ignoreRule) matches(rel string, isDir bool) bool {
+    if r.dirOnly && !isDir {
+        return false
+    }
+    if r.base != "" {
+        if !strings.HasPrefix(rel, r.base+"/") {
+            return false
+        }
+        rel = strings.TrimPrefix(rel, r.base+"/")
+    }
+    return r.re.MatchString(rel)
+}
+
+// parseRule compiles one gitignore line. ok is false for blank lines and
+// comments.
+func parseRule(line, base string) (ignoreRule, bool, error) {
+    line = strings.TrimRight(line, " \t\r")
+    if line == "" || strings.HasPrefix(line, "#") {
+        return ignoreRule{}, false, nil
+    }
+
+    rule := ignoreRule{base: base}
+    if strings.HasPrefix(line, "!") {
+        rule.negate = true
+        line = line[1:]
+    } else if strings.HasPrefix(line, `\`) {
+        line = line[1:]
+    }
+    if strings.HasSuffix(line, "/") {
+        rule.dirOnly = true
+        line = strings.TrimRight(line, "/")
+    }
+
+    // A slash anywhere but the end anchors the pattern to base; otherwise it
+    // matches a name at any depth.
+    anchored := strings.Contains(line, "/")
+    line = strings.TrimPrefix(line, "/")
+    if line == "" {
+        return ignoreRule{}, false, nil
+    }
+
+    expr := globToRegexp(line)
+    if !anchored {
+        expr = "(.*/)?" + expr
+    }
+    re, err := regexp.Compile("^" + expr + "$")
+    if err != nil {
+        return ignoreRule{}, false, fmt.Errorf("bad pattern %q: %v", line, err)
+    }
+    rule.re = re
+    return rule, true, nil
+}
+
+func globToRegexp(glob string) string {
+    var b strings.Builder
+    for i := 0; i < len(glob); i++ {
+        c := glob[i]
+        switch {
+        case strings.HasPrefix(glob[i:], "**/"):
+            b.WriteString("(.*/)?")
+            i += 2
+        case strings.HasPrefix(glob[i:], "**"):
+            b.WriteString(".*")
+            i++
+        case c == '*':
+            b.WriteString("[^/]*")
+        case c == '?':
+            b.WriteString("[^/]")
+        case c == '[':
+            end := strings.IndexByte(glob[i+1:], ']')
+            if end < 0 {
+                b.WriteString(`\[`)
+                continue
+            }
+            class := glob[i+1 : i+1+end]
+            if strings.HasPrefix(class, "!") {
+                class = "^" + class[1:]
+            }
+            b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+            i += end + 1
+        case c == '\\' && i+1 < len(glob):
+            i++
+            b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+        default:
+            b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+        }
+    }
+    return b.String()
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+    "os"
+    "path/filepath"
+    "testing"
+)
+
+func TestGlobToRegexp(t *testing.T) {
+    tests := []struct {
+        glob, want string
+    }{
+        {"*.tmp", `[^/]*\.tmp`},
+        {"file?.txt", `file[^/]\.txt`},
+        {"**/build", `(.*/)?build`},
+        {"logs/**", `logs/.*`},
+        {"a/**/b", `a/(.*/)?b`},
+        {"[abc].go", `[abc]\.go`},
+        {"[!abc].go", `[^abc]\.go`},
+        {"[unclosed", `\[unclosed`},
+        {`\*literal`, `\*literal`},
+    }
+    for _, tt := range tests {
+        if got := globToRegexp(tt.glob); got != tt.want {
+            t.Errorf("globToRegexp(%q) = %q, want %q", tt.glob, got, tt.want)
+        }
+    }
+}
+
+func TestParseRule(t *testing.T) {
+    tests := []struct {
+        line    string
+        ok      bool
+        negate  bool
+        dirOnly bool
+        expr    string
+    }{
+        {"", false, false, false, ""},
+        {"   ", false, false, false, ""},
+        {"# comment", false, false, false, ""},
+        {"*.tmp", true, false, false, `^(.*/)?[^/]*\.tmp$`},
+        {"/build", true, false, false, `^build$`},
+        {"docs/*.md", true, false, false, `^docs/[^/]*\.md$`},
+        {"node_modules/", true, false, true, `^(.*/)?node_modules$`},
+        {"!keep.tmp", true, true, false, `^(.*/)?keep\.tmp$`},
+        {`\#hash`, true, false, false, `^(.*/)?#hash$`},
+        {"/", false, false, false, ""},
+    }
+    for _, tt := range tests {
+        rule, ok, err := parseRule(tt.line, "")
+        if err != nil {
+            t.Errorf("parseRule(%q): %v", tt.line, err)
+            continue
+        }
+        if ok != tt.ok {
+            t.Errorf("parseRule(%q) ok = %v, want %v", tt.line, ok, tt.ok)
+            continue
+        }
+        if !ok {
+            continue
+        }
+        if rule.negate != tt.negate || rule.dirOnly != tt.dirOnly || rule.re.String() != tt.expr {
+            t.Errorf("parseRule(%q) = {negate %v, dirOnly %v, %s}, want {negate %v, dirOnly %v, %s}",
+                tt.line, rule.negate, rule.dirOnly, rule.re, tt.negate, tt.dirOnly, tt.expr)
+        }
+    }
+}
+
+func TestExcluded(t *testing.T) {
+    dir := t.TempDir()
+    ignore := "*.tmp\n!keep.tmp\n/build/\nnode_modules/\ndocs/**/draft*\n"
+    if err := os.WriteFile(filepath.Join(dir, IgnoreFile), []byte(ignore), 0644); err != nil {
+        t.Fatal(err)
+    }
+    f, err := newPathFilter(filterOptions{}, dir)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    tests := []struct {
+        rel   string
+        isDir bool
+        want  bool
+    }{
+        {"a.tmp", false, true},
+        {"deep/down/a.tmp", false, true},
+        {"keep.tmp", false, false},
+        {"sub/keep.tmp", false, false},
+        {"build", true, true},
+        {"build", false, false}, // dir-only rule, and this is a file
+        {"src/build", true, false}, // anchored to the root
+        {"node_modules", true, true},
+        {"web/node_modules", true, true},
+        {"docs/draft1.md", false, true},
+        {"docs/a/b/draft2.md", false, true},
+        {"docs/final.md", false, false},
+        {"main.go", false, false},
+        {".", true, false},
+    }
+    for _, tt := range tests {
+        if got := f.excluded(tt.rel, tt.isDir); got != tt.want {
+            t.Errorf("excluded(%q, dir=%v) = %v, want %v", tt.rel, tt.isDir, got, tt.want)
+        }
+    }
+}
+
+func TestExcludedNestedIgnoreFile(t *testing.T) {
+    dir := t.TempDir()
+    if err := os.WriteFile(filepath.Join(dir, IgnoreFile), []byte("*.log\n"), 0644); err != nil {
+        t.Fatal(err)
+    }
+    f, err := newPathFilter(filterOptions{}, "")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := f.loadIgnoreFile(filepath.Join(dir, IgnoreFile), "sub"); err != nil {
+        t.Fatal(err)
+    }
+    if !f.excluded("sub/a.log", false) {
+        t.Error("nested rule does not apply below its folder")
+    }
+    if f.excluded("a.log", false) || f.excluded("other/a.log", false) {
+        t.Error("nested rule applies outside its folder")
+    }
+}
+
+func TestCommandLineRulesWin(t *testing.T) {
+    dir := t.TempDir()
+    nested := filepath.Join(dir, "sub", IgnoreFile)
+    os.MkdirAll(filepath.Dir(nested), 0755)
+    if err := os.WriteFile(nested, []byte("!*.log\n!secret/\n"), 0644); err != nil {
+        t.Fatal(err)
+    }
+    excludeFrom := filepath.Join(dir, "excludes.txt")
+    if err := os.WriteFile(excludeFrom, []byte("secret/\n"), 0644); err != nil {
+        t.Fatal(err)
+    }
+
+    opts := filterOptions{Exclude: stringList{"*.log"}, ExcludeFrom: stringList{excludeFrom}}
+    f, err := newPathFilter(opts, dir)
+    if err != nil {
+        t.Fatal(err)
+    }
+    // Loaded later, as a walk reaches the folder.
+    if err := f.loadIgnoreFile(nested, "sub"); err != nil {
+        t.Fatal(err)
+    }
+    if !f.excluded("sub/a.log", false) {
+        t.Error("a nested .onedriveignore overrode --exclude")
+    }
+    if !f.excluded("sub/secret", true) {
+        t.Error("a nested .onedriveignore overrode --exclude-from")
+    }
+}
+
+func TestIncludes(t *testing.T) {
+    f, err := newPathFilter(filterOptions{Include: stringList{"*.pdf"}, Exclude: stringList{"old/"}}, "")
+    if err != nil {
+        t.Fatal(err)
+    }
+    tests := []struct {
+        rel   string
+        isDir bool
+        want  bool
+    }{
+        {"a.pdf", false, false},
+        {"reports/a.pdf", false, false},
+        {"a.txt", false, true},
+        {"reports", true, false}, // folders are walked to find matches
+        {"old", true, true},
+    }
+    for _, tt := range tests {
+        if got := f.excluded(tt.rel, tt.isDir); got != tt.want {
+            t.Errorf("excluded(%q, dir=%v) = %v, want %v", tt.rel, tt.isDir, got, tt.want)
+        }
+    }
+}
@@ -0,0 +1,5 @@
+module onedrivecli
+
+go 1.22
+
+require golang.org/x/text v0.22.0
@@ -0,0 +1,283 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "net/url"
+    "path"
+    "strings"
+)
+
+const (
+    graphBase  = "https://graph.microsoft.com/v1.0"
+    graphDrive = graphBase + "/me/drive"
+)
+
+type graphError struct {
+    StatusCode int
+    Code       string
+    Message    string
+}
+
+func (e *graphError) Error() string {
+    if e.Code != "" {
+        return fmt.Sprintf("%s: %s (HTTP %d)", e.Code, e.Message, e.StatusCode)
+    }
+    if e.Message != "" {
+        return fmt.Sprintf("HTTP %d: %s", e.StatusCode, e.Message)
+    }
+    return fmt.Sprintf("HTTP %d", e.StatusCode)
+}
+
+func isNotFound(err error) bool {
+    var ge *graphError
+    return errors.As(err, &ge) && ge.StatusCode == http.StatusNotFound
+}
+
+func isConflict(err error) bool {
+    var ge *graphError
+    return errors.As(err, &ge) && ge.StatusCode == http.StatusConflict
+}
+
+// splitDrive separates an optional "<driveId>:" prefix, used to address a
+// path in another drive the user can access ("b!xYz:/Shared/doc.txt").
+func splitDrive(remote string) (driveID, rest string) {
+    if i := strings.Index(remote, ":/"); i > 0 && !strings.Contains(remote[:i], "/") {
+        return remote[:i], remote[i+1:]
+    }
+    return "", remote
+}
+
+func joinDrive(driveID, p string) string {
+    if driveID == "" {
+        return p
+    }
+    return driveID + ":" + p
+}
+
+func driveURL(driveID string) string {
+    if driveID == "" {
+        return graphDrive
+    }
+    return graphBase + "/drives/" + url.PathEscape(driveID)
+}
+
+// itemURL returns the Graph endpoint for a remote path ("/Docs/a.txt") or,
+// when the argument has no leading slash, an item ID.
+func itemURL(remote string) string {
+    driveID, remote := splitDrive(remote)
+    base := driveURL(driveID)
+    if !strings.HasPrefix(remote, "/") {
+        return base + "/items/" + remote
+    }
+    p := strings.Trim(remote, "/")
+    if p == "" {
+        return base + "/root"
+    }
+    return base + "/root:/" + escapePath(p) + ":"
+}
+
+// itemIDURL addresses an already resolved item by ID within its own drive.
+func itemIDURL(item DriveItem) string {
+    return driveURL(driveIDOf(item)) + "/items/" + item.ID
+}
+
+func driveIDOf(item DriveItem) string {
+    if item.ParentReference == nil {
+        return ""
+    }
+    return item.ParentReference.DriveID
+}
+
+func childrenURL(remote string) string {
+    return itemURL(remote) + "/children"
+}
+
+// graphDo sends an authenticated request, JSON-encoding body when it is not
+// nil. On 401 it refreshes the token and retries once.
+func graphDo(ctx context.Context, method, endpoint string, body interface{}) (*http.Response, error) {
+    var payload []byte
+    if body != nil {
+        var err error
+        payload, err = json.Marshal(body)
+        if err != nil {
+            return nil, err
+        }
+    }
+
+    send := func(token string) (*http.Response, error) {
+        var r io.Reader
+        if payload != nil {
+            r = bytes.NewReader(payload)
+        }
+        req, err := http.NewRequestWithContext(ctx, method, endpoint, r)
+        if err != nil {
+            return nil, err
+        }
+        req.Header.Set("Authorization", "Bearer "+token)
+        if payload != nil {
+            req.Header.Set("Content-Type", "application/json")
+        }
+        return http.DefaultClient.Do(req)
+    }
+
+    return sendAuthorized(send)
+}
+
+// sendAuthorized calls send with the current access token. On 401 it
+// refreshes the token and calls send once more, so send must be able to
+// rebuild its request body.
+func sendAuthorized(send func(token string) (*http.Response, error)) (*http.Response, error) {
+    token := GetAccessToken()
+    resp, err := send(token)
+    if err != nil {
+        return nil, err
+    }
+    if resp.StatusCode == http.StatusUnauthorized {
+        resp.Body.Close()
+        return send(refreshRejectedToken(token))
+    }
+    return resp, nil
+}
+
+// graphJSON performs a request and decodes the JSON response into out.
+// Non-2xx responses are returned as *graphError.
+func graphJSON(ctx context.Context, method, endpoint string, body, out interface{}) error {
+    resp, err := graphDo(ctx, method, endpoint, body)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode >= 300 {
+        return readGraphError(resp)
+    }
+    if out == nil {
+        io.Copy(io.Discard, resp.Body)
+        return nil
+    }
+    return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func readGraphError(resp *http.Response) error {
+    body, _ := io.ReadAll(resp.Body)
+    var e struct {
+        Error struct {
+            Code    string `json:"code"`
+            Message string `json:"message"`
+        } `json:"error"`
+    }
+    json.Unmarshal(body, &e)
+
+    ge := &graphError{StatusCode: resp.StatusCode, Code: e.Error.Code, Message: e.Error.Message}
+    if ge.Code == "" {
+        ge.Message = strings.TrimSpace(string(body))
+    }
+    return ge
+}
+
+func getItem(ctx context.Context, remote string) (*DriveItem, error) {
+    var item DriveItem
+    if err := graphJSON(ctx, "GET", itemURL(remote), nil, &item); err != nil {
+        return nil, err
+    }
+    return &item, nil
+}
+
+// listChildren returns every child of a folder, following @odata.nextLink.
+func listChildren(ctx context.Context, remote string) ([]DriveItem, error) {
+    return listChildrenAt(ctx, childrenURL(remote))
+}
+
+func listChildrenAt(ctx context.Context, endpoint string) ([]DriveItem, error) {
+    var items []DriveItem
+    for endpoint != "" {
+        var page struct {
+            Value    []DriveItem `json:"value"`
+            NextLink string      `json:"@odata.nextLink"`
+        }
+        if err := graphJSON(ctx, "GET", endpoint, nil, &page); err != nil {
+            return nil, err
+        }
+        items = append(items, page.Value...)
+        endpoint = page.NextLink
+    }
+    return items, nil
+}
+
+// remoteEntry pairs a resolved item with the path it was found at.
+type remoteEntry struct {
+    Path string
+    Item DriveItem
+}
+
+func hasGlob(s string) bool {
+    return strings.ContainsAny(s, "*?[")
+}
+
+// expandRemote resolves a remote path whose segments may contain path.Match
+// patterns. A path without patterns resolves to exactly one entry or an error.
+func expandRemote(ctx context.Context, pattern string) ([]remoteEntry, error) {
+    driveID, pattern := splitDrive(pattern)
+    pattern = path.Clean("/" + pattern)
+    if !hasGlob(pattern) {
+        item, err := getItem(ctx, joinDrive(driveID, pattern))
+        if err != nil {
+            return nil, err
+        }
+        return []remoteEntry{{Path: joinDrive(driveID, pattern), Item: *item}}, nil
+    }
+
+    segs := strings.Split(strings.Trim(pattern, "/"), "/")
+    for _, seg := range segs {
+        if _, err := path.Match(seg, ""); err != nil {
+            return nil, fmt.Errorf("bad pattern %q: %v", pattern, err)
+        }
+    }
+
+    current := []remoteEntry{{Path: "/"}}
+    for _, seg := range segs {
+        var next []remoteEntry
+        for _, dir := range current {
+            if dir.Path != "/" && dir.Item.Folder == nil {
+                continue
+            }
+            if !hasGlob(seg) {
+                p := path.Join(dir.Path, seg)
+                item, err := getItem(ctx, joinDrive(driveID, p))
+                if isNotFound(err) {
+                    continue
+                }
+                if err != nil {
+                    return nil, err
+                }
+                next = append(next, remoteEntry{Path: p, Item: *item})
+                continue
+            }
+
+            children, err := listChildren(ctx, joinDrive(driveID, dir.Path))
+            if err != nil {
+                return nil, err
+            }
+            for _, child := range children {
+                if ok, _ := path.Match(seg, child.Name); ok {
+                    next = append(next, remoteEntry{Path: path.Join(dir.Path, child.Name), Item: child})
+                }
+            }
+        }
+        current = next
+    }
+
+    if len(current) == 0 {
+        return nil, fmt.Errorf("no match for %s", joinDrive(driveID, pattern))
+    }
+    for i := range current {
+        current[i].Path = joinDrive(driveID, current[i].Path)
+    }
+    return current, nil
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+    "bufio"
+    "context"
+    "crypto/sha1"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/hex"
+    "fmt"
+    "hash"
+    "io"
+    "os"
+    "path"
+    "path/filepath"
+    "strings"
+)
+
+// quickXorHash is the only hash every drive type reports, so it is the
+// default. Personal drives may also report SHA-1 and SHA-256.
+const defaultHashAlgorithm = "quickxor"
+
+type hashOptions struct {
+    Algorithm string // quickxor, sha1 or sha256
+    Remote    bool   // read the hashes OneDrive reports instead of local files
+}
+
+func newHasher(algo string) (hash.Hash, error) {
+    switch algo {
+    case "quickxor":
+        return newQuickXorHash(), nil
+    case "sha1":
+        return sha1.New(), nil
+    case "sha256":
+        return sha256.New(), nil
+    }
+    return nil, fmt.Errorf("unknown hash %q (want quickxor, sha1 or sha256)", algo)
+}
+
+// encodeHash formats a digest the way Graph does: base64 for quickXorHash,
+// hex for the others (lower case here, as sha1sum prints it).
+func encodeHash(algo string, sum []byte) string {
+    if algo == "quickxor" {
+        return base64.StdEncoding.EncodeToString(sum)
+    }
+    return hex.EncodeToString(sum)
+}
+
+// detectAlgorithm infers which hash produced sum from its length, so that
+// --check works on any list this command wrote.
+func detectAlgorithm(sum string) (string, error) {
+    switch len(sum) {
+    case base64.StdEncoding.EncodedLen(quickXorSize):
+        return "quickxor", nil
+    case sha1.Size * 2:
+        return "sha1", nil
+    case sha256.Size * 2:
+        return "sha256", nil
+    }
+    return "", fmt.Errorf("unrecognized hash %q", sum)
+}
+
+func hashLocalFile(file, algo string) (string, error) {
+    h, err := newHasher(algo)
+    if err != nil {
+        return "", err
+    }
+    f, err := os.Open(file)
+    if err != nil {
+        return "", err
+    }
+    defer f.Close()
+    if _, err := io.Copy(h, f); err != nil {
+        return "", err
+    }
+    return encodeHash(algo, h.Sum(nil)), nil
+}
+
+// remoteHash returns the hash OneDrive reports for item, or "" if the drive
+// does not provide that kind.
+func remoteHash(item DriveItem, algo string) string {
+    if item.File == nil || item.File.Hashes == nil {
+        return ""
+    }
+    switch algo {
+    case "quickxor":
+        return item.File.Hashes.QuickXorHash
+    case "sha1":
+        return strings.ToLower(item.File.Hashes.Sha1Hash)
+    case "sha256":
+        return strings.ToLower(item.File.Hashes.Sha256Hash)
+    }
+    return ""
+}
+
+// sameHash compares two encoded hashes; hex digests ignore case.
+func sameHash(algo, a, b string) bool {
+    if algo == "quickxor" {
+        return a == b
+    }
+    return strings.EqualFold(a, b)
+}
+
+// HashFiles prints a sha1sum-style line for every file under paths.
+func HashFiles(ctx context.Context, paths []string, opts hashOptions) error {
+    if _, err := newHasher(opts.Algorithm); err != nil {
+        return err
+    }
+
+    failed := 0
+    emit := func(name, sum string, err error) {
+        if err != nil {
+            fmt.Fprintln(os.Stderr, "❌", name+":", err)
+            failed++
+            return
+        }
+        fmt.Printf("%s  %s\n", sum, name)
+    }
+
+    for _, p := range paths {
+        if ctx.Err() != nil {
+            return ctx.Err()
+        }
+        if opts.Remote {
+            entries, err := expandRemote(ctx, p)
+            if err != nil {
+                emit(p, "", err)
+                continue
+            }
+            for _, entry := range entries {
+                if err := walkRemote(ctx, entry.Path, entry.Item, func(name string, item DriveItem) {
+                    if sum := remoteHash(item, opts.Algorithm); sum != "" {
+                        emit(name, sum, nil)
+                    } else {
+                        emit(name, "", fmt.Errorf("OneDrive reports no %s hash", opts.Algorithm))
+                    }
+                }); err != nil {
+                    emit(entry.Path, "", err)
+                }
+            }
+            continue
+        }
+
+        err := filepath.Walk(p, func(localPath string, info os.FileInfo, err error) error {
+            if ctx.Err() != nil {
+                return ctx.Err()
+            }
+            if err != nil {
+                emit(localPath, "", err)
+                return nil
+            }
+            if info.Mode().IsRegular() {
+                sum, err := hashLocalFile(localPath, opts.Algorithm)
+                emit(localPath, sum, err)
+            }
+            return nil
+        })
+        if ctx.Err() != nil {
+            return ctx.Err()
+        }
+        if err != nil {
+            emit(p, "", err)
+        }
+    }
+
+    if failed > 0 {
+        return fmt.Errorf("%d file(s) could not be hashed", failed)
+    }
+    return nil
+}
+
+// walkRemote calls fn for every file at or below item.
+func walkRemote(ctx context.Context, name string, item DriveItem, fn func(string, DriveItem)) error {
+    if item.Folder == nil {
+        fn(name, item)
+        return nil
+    }
+    children, err := listChildrenAt(ctx, itemIDURL(item) + "/children")
+    if err != nil {
+        return err
+    }
+    for _, child := range children {
+        if err := walkRemote(ctx, path.Join(name, child.Name), child, fn); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// CheckHashes reads lines written by HashFiles from listFile ("-" for stdin)
+// and reports whether each file still matches.
+func CheckHashes(ctx context.Context, listFile string, opts hashOptions) error {
+    in := os.Stdin
+    if listFile != "-" {
+        f, err := os.Open(listFile)
+        if err != nil {
+            return err
+        }
+        defer f.Close()
+        in = f
+    }
+
+    mismatched, unreadable := 0, 0
+    scanner := bufio.NewScanner(in)
+    for scanner.Scan() {
+        if ctx.Err() != nil {
+            return ctx.Err()
+        }
+        line := strings.TrimRight(scanner.Text(), "\r")
+        if line == "" {
+            continue
+        }
+        want, name, ok := strings.Cut(line, "  ")
+        if !ok {
+            // sha1sum marks binary mode with " *" instead of two spaces.
+            want, name, ok = strings.Cut(line, " *")
+        }
+        if !ok {
+            return fmt.Errorf("malformed line: %q", line)
+        }
+        algo, err := detectAlgorithm(want)
+        if err != nil {
+            return err
+        }
+
+        var got string
+        if opts.Remote {
+            var item *DriveItem
+            if item, err = getItem(ctx, name); err == nil {
+                if got = remoteHash(*item, algo); got == "" {
+                    err = fmt.Errorf("OneDrive reports no %s hash", algo)
+                }
+            }
+        } else {
+            got, err = hashLocalFile(name, algo)
+        }
+
+        switch {
+        case err != nil:
+            fmt.Printf("%s: FAILED (%v)\n", name, err)
+            unreadable++
+        case !sameHash(algo, got, want):
+            fmt.Printf("%s: FAILED\n", name)
+            mismatched++
+        default:
+            fmt.Printf("%s: OK\n", name)
+        }
+    }
+    if err := scanner.Err(); err != nil {
+        return err
+    }
+
+    if mismatched > 0 || unreadable > 0 {
+        return fmt.Errorf("%d file(s) did not match, %d could not be read", mismatched, unreadable)
+    }
+    return nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "os"
+    "os/signal"
+    "syscall"
+    "time"
+)
+
+var errInterrupted = errors.New("interrupted")
+
+// interruptContext is cancelled by the first SIGINT or SIGTERM so that
+// transfers can stop cleanly. A second signal kills the process as usual.
+func interruptContext() context.Context {
+    ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+    go func() {
+        <-ctx.Done()
+        stop()
+        // stderr, so that the message never ends up in `cat` output.
+        fmt.Fprintln(os.Stderr, "\n⏹️ Interrupted, stopping... (press Ctrl-C again to quit immediately)")
+    }()
+    return ctx
+}
+
+// validInterrupt checks an --on-interrupt policy: keep leaves .partial files
+// and upload sessions to be resumed later, discard removes them.
+func validInterrupt(policy string) error {
+    switch policy {
+    case "keep", "discard":
+        return nil
+    }
+    return fmt.Errorf("invalid --on-interrupt %q (want keep or discard)", policy)
+}
+
+// sleepContext waits for d, or returns early with ctx's error.
+func sleepContext(ctx context.Context, d time.Duration) error {
+    t := time.NewTimer(d)
+    defer t.Stop()
+    select {
+    case <-t.C:
+        return nil
+    case <-ctx.Done():
+        return ctx.Err()
+    }
+}
+
+// cleanupContext is for work that must still happen after ctx has been
+// cancelled, such as cancelling an upload session.
+func cleanupContext() (context.Context, context.CancelFunc) {
+    return context.WithTimeout(context.Background(), 10*time.Second)
+}
@@ -7,6 +7,7 @@ import (
     "net/http"
     "net/url"
     "strings"
+    "time"
 )
 
 type DriveItem struct {
@@ -16,9 +17,46 @@ type DriveItem struct {
     Folder      *struct {
         ChildCount int `json:"childCount"`
     } `json:"folder,omitempty"`
-    File        *struct{}   `json:"file,omitempty"`
+    File        *FileFacet  `json:"file,omitempty"`
     DownloadURL string      `json:"@microsoft.graph.downloadUrl,omitempty"`
     Children    []DriveItem `json:"value,omitempty"`
+
+    ETag                 string          `json:"eTag,omitempty"`
+    ParentReference      *ItemReference  `json:"parentReference,omitempty"`
+    LastModifiedDateTime time.Time       `json:"lastModifiedDateTime"`
+    FileSystemInfo       *FileSystemInfo `json:"fileSystemInfo,omitempty"`
+}
+
+type FileFacet struct {
+    MimeType string  `json:"mimeType,omitempty"`
+    Hashes   *Hashes `json:"hashes,omitempty"`
+}
+
+type Hashes struct {
+    Sha1Hash     string `json:"sha1Hash,omitempty"`
+    Sha256Hash   string `json:"sha256Hash,omitempty"`
+    QuickXorHash string `json:"quickXorHash,omitempty"`
+}
+
+type FileSystemInfo struct {
+    CreatedDateTime      time.Time `json:"createdDateTime"`
+    LastModifiedDateTime time.Time `json:"lastModifiedDateTime"`
+}
+
+type ItemReference struct {
+    DriveID   string `json:"driveId,omitempty"`
+    DriveType string `json:"driveType,omitempty"`
+    ID        string `json:"id,omitempty"`
+    Path      string `json:"path,omitempty"`
+}
+
+// modTime is the item's last modified time as the client that wrote it saw
+// it, falling back to when the service last changed it.
+func (item DriveItem) modTime() time.Time {
+    if item.FileSystemInfo != nil && !item.FileSystemInfo.LastModifiedDateTime.IsZero() {
+        return item.FileSystemInfo.LastModifiedDateTime
+    }
+    return item.LastModifiedDateTime
 }
 
 type DriveResponse struct {
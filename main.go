@@ -1,6 +1,7 @@
 package main
 
 import (
+    "flag"
     "fmt"
     "log"
     "os"
@@ -17,6 +18,14 @@ func main() {
         fmt.Println("  dl <path>               Generate a direct download link")
         fmt.Println("  download <remote> <local> Download a file or folder with progress")
         fmt.Println("  upload <remote> <local> Upload a file or folder with progress")
+        fmt.Println("  uploads list|cancel     Manage resumable upload sessions")
+        fmt.Println("  mkdir [-p] <remote>     Create a remote folder")
+        fmt.Println("  rm [-r] <remote>...     Delete remote items (recycle bin by default)")
+        fmt.Println("  mv <src>... <dst>       Move or rename remote items")
+        fmt.Println("  rename <remote> <name>  Rename a remote item")
+        fmt.Println("  cp <src>... <dst>       Copy remote items server-side")
+        fmt.Println("  cat <remote>            Stream a remote file to stdout")
+        fmt.Println("  hash <path>...          Print or check file hashes (quickXorHash by default)")
         fmt.Println("  storage                 Check OneDrive storage usage")
         fmt.Println("  explorer                Interactive OneDrive explorer")
         return
@@ -58,27 +67,206 @@ func main() {
         }
 
     case "download":
-        if len(os.Args) < 4 {
-            fmt.Println("Usage: onedrivecli download <remote_path_or_id> <local_path>")
+        fs := flag.NewFlagSet("download", flag.ExitOnError)
+        var opts downloadOptions
+        fs.BoolVar(&opts.NoTimes, "no-times", false, "do not set local modified times from OneDrive")
+        fs.StringVar(&opts.Verify, "verify", "hash", "check downloads: off, size or hash")
+        fs.IntVar(&opts.Segments, "segments", 1, "fetch large files over this many connections (not resumable)")
+        fs.IntVar(&opts.Workers, "workers", 4, "number of files to download in parallel")
+        fs.BoolVar(&opts.SkipExisting, "skip-existing", false, "do not replace files that already exist locally")
+        fs.BoolVar(&opts.IfNewer, "if-newer", false, "only replace local files older than the remote file")
+        fs.BoolVar(&opts.IfChanged, "if-changed", false, "only replace local files whose size or hash differ")
+        fs.BoolVar(&opts.DryRun, "dry-run", false, "show what would be downloaded without downloading")
+        fs.StringVar(&opts.OnInterrupt, "on-interrupt", "keep", "on Ctrl-C: keep .partial files to resume later, or discard them")
+        fs.StringVar(&opts.Archive, "archive", "", `stream into one tar, tar.gz or zip archive; local path "-" is stdout`)
+        bwlimit := fs.String("bwlimit", "", `cap the transfer rate, e.g. 5M or "08:00,2M 18:00,off"`)
+        opts.Filters.register(fs)
+        fs.Parse(os.Args[2:])
+        if err := setBwLimit(*bwlimit); err != nil {
+            log.Fatal("Download failed:", err)
+        }
+        if fs.NArg() < 2 {
+            fmt.Println("Usage: onedrivecli download [--archive tar|tar.gz|zip] [--bwlimit rate] [--on-interrupt keep|discard] [--skip-existing] [--if-newer] [--if-changed] [--dry-run] [--workers N] [--segments N] [--no-times] [--verify off|size|hash] [--include glob] [--exclude glob] [--exclude-from file] <remote_path_or_id> <local_path|->")
             return
         }
-        remote := os.Args[2]
-        local := os.Args[3]
-        if err := StartDownload(remote, local); err != nil {
+        remote := fs.Arg(0)
+        local := fs.Arg(1)
+        if err := StartDownload(interruptContext(), remote, local, opts); err != nil {
             log.Fatal("Download failed:", err)
         }
 
     case "upload":
-        if len(os.Args) < 4 {
-            fmt.Println("Usage: onedrivecli upload <remote_path> <local_path>")
+        fs := flag.NewFlagSet("upload", flag.ExitOnError)
+        resume := fs.Bool("resume", false, "continue all saved upload sessions")
+        var opts uploadOptions
+        fs.StringVar(&opts.OnConflict, "on-conflict", "replace", "when the remote file exists: replace, rename, fail or skip")
+        fs.BoolVar(&opts.IfNewer, "if-newer", false, "only replace remote files older than the local file")
+        fs.BoolVar(&opts.IfChanged, "if-changed", false, "only replace remote files whose size or hash differ")
+        fs.IntVar(&opts.Workers, "workers", 4, "number of files to upload in parallel")
+        fs.BoolVar(&opts.Sanitize, "sanitize", false, "replace characters OneDrive rejects with Unicode lookalikes")
+        fs.StringVar(&opts.OnCollision, "on-collision", "fail", "when local names differ only by case or Unicode form: fail, rename or skip")
+        fs.BoolVar(&opts.NoNormalize, "no-normalize", false, "do not normalize names to Unicode NFC")
+        fs.BoolVar(&opts.NoTimes, "no-times", false, "do not send local created/modified times to OneDrive")
+        fs.StringVar(&opts.Verify, "verify", "hash", "check uploads: off, size or hash")
+        fs.StringVar(&opts.OnInterrupt, "on-interrupt", "keep", "on Ctrl-C: keep upload sessions for --resume or discard them")
+        bwlimit := fs.String("bwlimit", "", `cap the transfer rate, e.g. 5M or "08:00,2M 18:00,off"`)
+        opts.Filters.register(fs)
+        fs.Parse(os.Args[2:])
+        if err := setBwLimit(*bwlimit); err != nil {
+            log.Fatal("Upload failed:", err)
+        }
+        if *resume {
+            if err := ResumeUploads(interruptContext(), opts); err != nil {
+                log.Fatal("Upload failed:", err)
+            }
+            return
+        }
+        if fs.NArg() < 2 {
+            fmt.Println("Usage: onedrivecli upload [--bwlimit rate] [--on-interrupt keep|discard] [--on-conflict replace|rename|fail|skip] [--if-newer] [--if-changed] [--workers N] [--sanitize] [--on-collision fail|rename|skip] [--no-times] [--verify off|size|hash] [--include glob] [--exclude glob] [--exclude-from file] <remote_path> <local_path>")
+            fmt.Println("       onedrivecli upload - <remote_path>    (read from stdin)")
+            fmt.Println("       onedrivecli upload [--bwlimit rate] [--on-interrupt keep|discard] [--on-conflict replace|rename|fail|skip] [--if-newer] [--if-changed] [--verify off|size|hash] --resume")
             return
         }
-        remote := os.Args[2]
-        local := os.Args[3]
-        if err := StartUpload(remote, local); err != nil {
+        remote := fs.Arg(0)
+        local := fs.Arg(1)
+        if remote == "-" {
+            remote, local = local, remote
+        }
+        if err := StartUpload(interruptContext(), remote, local, opts); err != nil {
             log.Fatal("Upload failed:", err)
         }
 
+    case "uploads":
+        if len(os.Args) < 3 {
+            fmt.Println("Usage: onedrivecli uploads list")
+            fmt.Println("       onedrivecli uploads cancel <remote_path>... | --all")
+            return
+        }
+        switch os.Args[2] {
+        case "list":
+            if err := ListUploads(interruptContext()); err != nil {
+                log.Fatal("uploads failed:", err)
+            }
+        case "cancel":
+            fs := flag.NewFlagSet("uploads cancel", flag.ExitOnError)
+            all := fs.Bool("all", false, "cancel every saved upload session")
+            fs.Parse(os.Args[3:])
+            if !*all && fs.NArg() == 0 {
+                fmt.Println("Usage: onedrivecli uploads cancel <remote_path>... | --all")
+                return
+            }
+            if err := CancelUploads(interruptContext(), fs.Args(), *all); err != nil {
+                log.Fatal("uploads failed:", err)
+            }
+        default:
+            fmt.Println("Unknown uploads subcommand:", os.Args[2])
+        }
+
+    case "mkdir":
+        fs := flag.NewFlagSet("mkdir", flag.ExitOnError)
+        parents := fs.Bool("p", false, "create missing parent folders; an existing folder is not an error")
+        conflict := fs.String("on-conflict", "fail", "behavior when the name exists: fail, rename or replace")
+        fs.Parse(os.Args[2:])
+        if fs.NArg() < 1 {
+            fmt.Println("Usage: onedrivecli mkdir [-p] [--on-conflict fail|rename|replace] <remote>...")
+            return
+        }
+        ctx := interruptContext()
+        for _, remote := range fs.Args() {
+            if err := MakeDir(ctx, remote, *parents, *conflict); err != nil {
+                log.Fatal("mkdir failed:", err)
+            }
+        }
+
+    case "rm":
+        fs := flag.NewFlagSet("rm", flag.ExitOnError)
+        var opts removeOptions
+        fs.BoolVar(&opts.Recursive, "r", false, "allow removing folders and their contents")
+        fs.BoolVar(&opts.DryRun, "dry-run", false, "show what would be deleted without deleting")
+        fs.BoolVar(&opts.Permanent, "permanent", false, "skip the recycle bin where the drive supports it")
+        fs.BoolVar(&opts.Yes, "yes", false, "do not ask for confirmation before deleting folders")
+        fs.Parse(os.Args[2:])
+        if fs.NArg() < 1 {
+            fmt.Println("Usage: onedrivecli rm [-r] [--dry-run] [--permanent] [--yes] <remote>...")
+            return
+        }
+        if err := Remove(interruptContext(), fs.Args(), opts); err != nil {
+            log.Fatal("rm failed:", err)
+        }
+
+    case "mv":
+        fs := flag.NewFlagSet("mv", flag.ExitOnError)
+        conflict := fs.String("on-conflict", "fail", "behavior when the target name exists: fail, rename or replace")
+        fs.Parse(os.Args[2:])
+        if fs.NArg() < 2 {
+            fmt.Println("Usage: onedrivecli mv [--on-conflict fail|rename|replace] <src>... <dst>")
+            return
+        }
+        args := fs.Args()
+        if err := Move(interruptContext(), args[:len(args)-1], args[len(args)-1], *conflict); err != nil {
+            log.Fatal("mv failed:", err)
+        }
+
+    case "rename":
+        fs := flag.NewFlagSet("rename", flag.ExitOnError)
+        conflict := fs.String("on-conflict", "fail", "behavior when the new name exists: fail, rename or replace")
+        fs.Parse(os.Args[2:])
+        if fs.NArg() < 2 {
+            fmt.Println("Usage: onedrivecli rename [--on-conflict fail|rename|replace] <remote> <new_name>")
+            return
+        }
+        if err := Rename(interruptContext(), fs.Arg(0), fs.Arg(1), *conflict); err != nil {
+            log.Fatal("rename failed:", err)
+        }
+
+    case "cp":
+        fs := flag.NewFlagSet("cp", flag.ExitOnError)
+        conflict := fs.String("on-conflict", "fail", "behavior when the target name exists: fail, rename or replace")
+        fs.Parse(os.Args[2:])
+        if fs.NArg() < 2 {
+            fmt.Println("Usage: onedrivecli cp [--on-conflict fail|rename|replace] <src>... <dst>")
+            fmt.Println("       <dst> may name another drive as <driveId>:/path")
+            return
+        }
+        args := fs.Args()
+        if err := Copy(interruptContext(), args[:len(args)-1], args[len(args)-1], *conflict); err != nil {
+            log.Fatal("cp failed:", err)
+        }
+
+    case "cat":
+        fs := flag.NewFlagSet("cat", flag.ExitOnError)
+        byteRange := fs.String("range", "", "only output bytes start-end (inclusive)")
+        fs.Parse(os.Args[2:])
+        if fs.NArg() < 1 {
+            fmt.Fprintln(os.Stderr, "Usage: onedrivecli cat [--range start-end] <remote_path_or_id>")
+            os.Exit(2)
+        }
+        if err := Cat(interruptContext(), fs.Arg(0), *byteRange); err != nil {
+            log.Fatal("cat failed:", err)
+        }
+
+    case "hash":
+        fs := flag.NewFlagSet("hash", flag.ExitOnError)
+        var opts hashOptions
+        fs.StringVar(&opts.Algorithm, "algo", defaultHashAlgorithm, "hash to print: quickxor, sha1 or sha256")
+        fs.BoolVar(&opts.Remote, "remote", false, "use the hashes OneDrive reports for remote paths")
+        check := fs.String("check", "", "verify the hashes listed in a file (- for stdin)")
+        fs.Parse(os.Args[2:])
+        var err error
+        switch {
+        case *check != "":
+            err = CheckHashes(interruptContext(), *check, opts)
+        case fs.NArg() > 0:
+            err = HashFiles(interruptContext(), fs.Args(), opts)
+        default:
+            fmt.Fprintln(os.Stderr, "Usage: onedrivecli hash [--algo quickxor|sha1|sha256] [--remote] <path>...")
+            fmt.Fprintln(os.Stderr, "       onedrivecli hash [--remote] --check <list_file>")
+            os.Exit(2)
+        }
+        if err != nil {
+            log.Fatal("hash failed:", err)
+        }
+
     case "storage":
         CheckStorage()
 
@@ -0,0 +1,84 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "path"
+)
+
+// MakeDir creates a remote folder. With parents set, missing intermediate
+// folders are created too and an existing folder is not an error.
+func MakeDir(ctx context.Context, remote string, parents bool, conflict string) error {
+    if err := validConflict(conflict); err != nil {
+        return err
+    }
+
+    remote = path.Clean("/" + remote)
+    if remote == "/" {
+        return fmt.Errorf("cannot create the drive root")
+    }
+    parent, name := path.Split(remote)
+
+    if parents {
+        if _, err := ensureFolder(ctx, parent); err != nil {
+            return err
+        }
+        if conflict == "fail" {
+            item, err := getItem(ctx, remote)
+            if err == nil && item.Folder != nil {
+                fmt.Println("📁 Already exists:", remote)
+                return nil
+            }
+            if err != nil && !isNotFound(err) {
+                return err
+            }
+        }
+    }
+
+    item, err := createFolder(ctx, parent, name, conflict)
+    if err != nil {
+        return err
+    }
+    fmt.Println("📁 Created:", path.Join(parent, item.Name))
+    return nil
+}
+
+func createFolder(ctx context.Context, parent, name, conflict string) (*DriveItem, error) {
+    body := map[string]interface{}{
+        "name":                              name,
+        "folder":                            map[string]interface{}{},
+        "@microsoft.graph.conflictBehavior": conflict,
+    }
+    var item DriveItem
+    if err := graphJSON(ctx, "POST", childrenURL(parent), body, &item); err != nil {
+        return nil, err
+    }
+    return &item, nil
+}
+
+// ensureFolder makes sure remote exists as a folder, creating it and any
+// missing parents.
+func ensureFolder(ctx context.Context, remote string) (*DriveItem, error) {
+    remote = path.Clean("/" + remote)
+    item, err := getItem(ctx, remote)
+    if err == nil {
+        if item.Folder == nil {
+            return nil, fmt.Errorf("%s exists and is not a folder", remote)
+        }
+        return item, nil
+    }
+    if !isNotFound(err) || remote == "/" {
+        return nil, err
+    }
+
+    parent, name := path.Split(remote)
+    if _, err := ensureFolder(ctx, parent); err != nil {
+        return nil, err
+    }
+    item, err = createFolder(ctx, parent, name, "fail")
+    if isConflict(err) {
+        // Someone else created it between our GET and POST.
+        return ensureFolder(ctx, remote)
+    }
+    return item, err
+}
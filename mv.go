@@ -0,0 +1,149 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "net/url"
+    "path"
+    "strings"
+)
+
+func validConflict(conflict string) error {
+    switch conflict {
+    case "fail", "rename", "replace":
+        return nil
+    }
+    return fmt.Errorf("invalid conflict behavior %q (want fail, rename or replace)", conflict)
+}
+
+// Move moves or renames items within a drive. With several sources (or a
+// glob), dst must be an existing folder.
+func Move(ctx context.Context, sources []string, dst, conflict string) error {
+    if err := validConflict(conflict); err != nil {
+        return err
+    }
+
+    var entries []remoteEntry
+    for _, src := range sources {
+        matched, err := expandRemote(ctx, src)
+        if err != nil {
+            return err
+        }
+        entries = append(entries, matched...)
+    }
+
+    parent, newName, err := resolveDestination(ctx, dst, len(entries) > 1)
+    if err != nil {
+        return err
+    }
+
+    failed := 0
+    for _, entry := range entries {
+        if err := moveItem(ctx, entry, parent, newName, conflict); err != nil {
+            fmt.Println("❌", entry.Path+":", err)
+            failed++
+        }
+    }
+    if failed > 0 {
+        return fmt.Errorf("%d item(s) could not be moved", failed)
+    }
+    return nil
+}
+
+// Rename changes an item's name in place.
+func Rename(ctx context.Context, remote, newName, conflict string) error {
+    if err := validConflict(conflict); err != nil {
+        return err
+    }
+    if newName == "" || strings.Contains(newName, "/") {
+        return fmt.Errorf("new name must be a plain name, not a path")
+    }
+
+    driveID, p := splitDrive(remote)
+    entry := remoteEntry{Path: joinDrive(driveID, path.Clean("/"+p))}
+    item, err := getItem(ctx, entry.Path)
+    if err != nil {
+        return err
+    }
+    entry.Item = *item
+    return moveItem(ctx, entry, nil, newName, conflict)
+}
+
+// resolveDestination works out the target folder and, when dst names a new
+// item rather than an existing folder, the new name.
+func resolveDestination(ctx context.Context, dst string, multiple bool) (*DriveItem, string, error) {
+    driveID, p := splitDrive(dst)
+    wantFolder := strings.HasSuffix(p, "/")
+    p = path.Clean("/" + p)
+
+    item, err := getItem(ctx, joinDrive(driveID, p))
+    if err == nil && item.Folder != nil {
+        return item, "", nil
+    }
+    if err != nil && !isNotFound(err) {
+        return nil, "", err
+    }
+    if multiple || wantFolder {
+        return nil, "", fmt.Errorf("destination %s is not an existing folder", dst)
+    }
+
+    parentPath, name := path.Split(p)
+    parent, err := getItem(ctx, joinDrive(driveID, parentPath))
+    if err != nil {
+        return nil, "", fmt.Errorf("destination folder %s: %w", parentPath, err)
+    }
+    if parent.Folder == nil {
+        return nil, "", fmt.Errorf("destination %s is not a folder", parentPath)
+    }
+    return parent, name, nil
+}
+
+func moveItem(ctx context.Context, entry remoteEntry, parent *DriveItem, newName, conflict string) error {
+    body := map[string]interface{}{}
+    target := entry.Path
+
+    if parent != nil {
+        srcDrive, dstDrive := driveIDOf(entry.Item), driveIDOf(*parent)
+        if srcDrive != "" && dstDrive != "" && !strings.EqualFold(srcDrive, dstDrive) {
+            return fmt.Errorf("cannot move across drives (%s -> %s); use cp and then rm instead", srcDrive, dstDrive)
+        }
+        if entry.Item.ParentReference == nil || entry.Item.ParentReference.ID != parent.ID {
+            body["parentReference"] = map[string]string{"id": parent.ID}
+        }
+        target = remotePathOf(*parent)
+    }
+
+    if newName != "" && newName != entry.Item.Name {
+        body["name"] = newName
+    }
+    if len(body) == 0 {
+        fmt.Println("⏭️ Nothing to do:", entry.Path)
+        return nil
+    }
+
+    endpoint := itemIDURL(entry.Item) + "?@microsoft.graph.conflictBehavior=" + url.QueryEscape(conflict)
+    var moved DriveItem
+    if err := graphJSON(ctx, "PATCH", endpoint, body, &moved); err != nil {
+        return err
+    }
+
+    if parent == nil {
+        target = path.Dir(entry.Path)
+    }
+    fmt.Printf("📦 Moved: %s -> %s\n", entry.Path, path.Join(target, moved.Name))
+    return nil
+}
+
+// remotePathOf rebuilds an item's drive path from its parentReference, which
+// Graph reports as "/drive/root:/Folder". The root itself has no parent path.
+func remotePathOf(item DriveItem) string {
+    if item.ParentReference == nil || item.ParentReference.Path == "" {
+        return "/"
+    }
+    parent := item.ParentReference.Path
+    if i := strings.Index(parent, "root:"); i >= 0 {
+        parent = parent[i+len("root:"):]
+    }
+    parent, _ = url.PathUnescape(parent)
+    return path.Join("/", parent, item.Name)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "path/filepath"
+    "sync"
+)
+
+// PartialsFile is absolute so that a download repeated from another
+// directory still finds its partial files.
+var PartialsFile = statePath("partial_downloads.json")
+
+// A download in progress is written to "<name>.partial" and renamed when it
+// completes.
+const partialSuffix = ".partial"
+
+// partialDownload records which version of a remote file a .partial file
+// holds, so that a later run only resumes it if the file is unchanged.
+type partialDownload struct {
+    ETag string `json:"eTag"`
+}
+
+var partialsMu sync.Mutex
+
+func loadPartials() (map[string]partialDownload, error) {
+    partials := map[string]partialDownload{}
+    data, err := os.ReadFile(PartialsFile)
+    if os.IsNotExist(err) {
+        return partials, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    if err := json.Unmarshal(data, &partials); err != nil {
+        return nil, fmt.Errorf("%s: %w", PartialsFile, err)
+    }
+    return partials, nil
+}
+
+func savePartials(partials map[string]partialDownload) error {
+    if len(partials) == 0 {
+        err := os.Remove(PartialsFile)
+        if os.IsNotExist(err) {
+            return nil
+        }
+        return err
+    }
+    data, err := json.MarshalIndent(partials, "", "  ")
+    if err != nil {
+        return err
+    }
+    return writeState(PartialsFile, data, 0600)
+}
+
+func partialKey(partial string) string {
+    abs, _ := filepath.Abs(partial)
+    return abs
+}
+
+func findPartial(partial string) (partialDownload, bool) {
+    partialsMu.Lock()
+    defer partialsMu.Unlock()
+    partials, err := loadPartials()
+    if err != nil {
+        return partialDownload{}, false
+    }
+    p, ok := partials[partialKey(partial)]
+    return p, ok
+}
+
+func rememberPartial(partial string, p partialDownload) {
+    partialsMu.Lock()
+    defer partialsMu.Unlock()
+    partials, err := loadPartials()
+    if err != nil {
+        fmt.Println("⚠️ Could not load partial downloads:", err)
+        return
+    }
+    partials[partialKey(partial)] = p
+    if err := savePartials(partials); err != nil {
+        fmt.Println("⚠️ Could not save partial download:", err)
+    }
+}
+
+func forgetPartial(partial string) {
+    partialsMu.Lock()
+    defer partialsMu.Unlock()
+    partials, err := loadPartials()
+    if err != nil {
+        return
+    }
+    key := partialKey(partial)
+    if _, ok := partials[key]; !ok {
+        return
+    }
+    delete(partials, key)
+    savePartials(partials)
+}
+
+// resumeOffset returns how much of item the .partial file already holds.
+// A partial left by a different version of the file is discarded.
+func resumeOffset(partial string, item *DriveItem) int64 {
+    info, err := os.Stat(partial)
+    if err != nil {
+        forgetPartial(partial)
+        return 0
+    }
+    p, ok := findPartial(partial)
+    if ok && item.ETag != "" && p.ETag == item.ETag && info.Size() <= item.Size {
+        return info.Size()
+    }
+    discardPartial(partial)
+    return 0
+}
+
+func discardPartial(partial string) {
+    os.Remove(partial)
+    forgetPartial(partial)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+    "fmt"
+    "io"
+    "os"
+    "runtime"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "time"
+)
+
+// transferProgress aggregates byte and file counts across concurrent
+// transfers and redraws a single status line until stopped.
+type transferProgress struct {
+    bytes      int64 // updated atomically
+    files      int64 // updated atomically
+    totalBytes int64 // <= 0 when unknown, e.g. reading from a pipe
+    totalFiles int64
+    start      time.Time
+    done       chan struct{}
+    stopOnce   sync.Once
+    wg         sync.WaitGroup
+}
+
+var printMu sync.Mutex
+
+// statusOut receives the progress line and printLine messages. It is stderr
+// while stdout carries data, such as an archive being streamed.
+var statusOut io.Writer = os.Stdout
+
+// clearLine returns to the start of the line and blanks it. Legacy Windows
+// consoles do not understand the ANSI erase sequence, so overwrite instead.
+func clearLine() string {
+    if runtime.GOOS == "windows" {
+        return "\r" + strings.Repeat(" ", 110) + "\r"
+    }
+    return "\r\033[K"
+}
+
+func startProgress(totalBytes, totalFiles int64) *transferProgress {
+    p := &transferProgress{
+        totalBytes: totalBytes,
+        totalFiles: totalFiles,
+        start:      time.Now(),
+        done:       make(chan struct{}),
+    }
+    p.wg.Add(1)
+    go func() {
+        defer p.wg.Done()
+        ticker := time.NewTicker(200 * time.Millisecond)
+        defer ticker.Stop()
+        for {
+            select {
+            case <-ticker.C:
+                p.render()
+            case <-p.done:
+                p.render()
+                fmt.Fprintln(statusOut)
+                return
+            }
+        }
+    }()
+    return p
+}
+
+func (p *transferProgress) addBytes(n int64) {
+    atomic.AddInt64(&p.bytes, n)
+}
+
+func (p *transferProgress) fileDone() {
+    atomic.AddInt64(&p.files, 1)
+}
+
+// stop draws the final state and ends the status line.
+func (p *transferProgress) stop() {
+    p.stopOnce.Do(func() { close(p.done) })
+    p.wg.Wait()
+}
+
+func (p *transferProgress) render() {
+    done := atomic.LoadInt64(&p.bytes)
+    elapsed := time.Since(p.start).Seconds()
+    speed := float64(done) / 1024 / 1024 / elapsed
+
+    line := ""
+    if p.totalFiles > 1 {
+        line = fmt.Sprintf("%d/%d files | ", atomic.LoadInt64(&p.files), p.totalFiles)
+    }
+    if p.totalBytes > 0 {
+        eta := "-"
+        if speed > 0 {
+            eta = fmt.Sprintf("%.1fs", float64(p.totalBytes-done)/1024/1024/speed)
+        }
+        line += fmt.Sprintf("%.2f%% | %d/%d MB | %.2f MB/s | Elapsed: %.1fs | ETA: %s",
+            float64(done)/float64(p.totalBytes)*100, done/1024/1024, p.totalBytes/1024/1024, speed, elapsed, eta)
+    } else {
+        line += fmt.Sprintf("%d MB | %.2f MB/s | Elapsed: %.1fs", done/1024/1024, speed, elapsed)
+    }
+
+    printMu.Lock()
+    fmt.Fprint(statusOut, clearLine()+line)
+    printMu.Unlock()
+}
+
+// printLine prints a message on its own line without tearing the progress
+// line; the next tick redraws it underneath.
+func printLine(format string, args ...interface{}) {
+    printMu.Lock()
+    fmt.Fprintf(statusOut, clearLine()+format+"\n", args...)
+    printMu.Unlock()
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+    "encoding/binary"
+    "hash"
+)
+
+const (
+    quickXorWidth = 160 // bits
+    quickXorShift = 11
+    quickXorSize  = quickXorWidth / 8
+)
+
+// quickXorHash is the hash OneDrive reports for every file. Each input byte
+// is XORed into a 160-bit circular buffer, 11 bits further along than the
+// byte before it, and the total length is XORed into the last 64 bits.
+type quickXorHash struct {
+    data   [quickXorSize]byte
+    shift  int
+    length int64
+}
+
+func newQuickXorHash() hash.Hash {
+    return &quickXorHash{}
+}
+
+func (h *quickXorHash) Write(p []byte) (int, error) {
+    for _, c := range p {
+        i, bit := h.shift/8, uint(h.shift%8)
+        h.data[i] ^= c << bit
+        if bit > 0 {
+            // The byte straddles two buffer bytes, wrapping at the end.
+            h.data[(i+1)%quickXorSize] ^= c >> (8 - bit)
+        }
+        h.shift = (h.shift + quickXorShift) % quickXorWidth
+    }
+    h.length += int64(len(p))
+    return len(p), nil
+}
+
+func (h *quickXorHash) Sum(b []byte) []byte {
+    sum := h.data
+    var length [8]byte
+    binary.LittleEndian.PutUint64(length[:], uint64(h.length))
+    for i, c := range length {
+        sum[quickXorSize-8+i] ^= c
+    }
+    return append(b, sum[:]...)
+}
+
+func (h *quickXorHash) Reset() {
+    *h = quickXorHash{}
+}
+
+func (h *quickXorHash) Size() int {
+    return quickXorSize
+}
+
+func (h *quickXorHash) BlockSize() int {
+    return 64
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+    "encoding/base64"
+    "strings"
+    "testing"
+)
+
+// The expected values were computed with a direct port of Microsoft's
+// reference QuickXorHash.cs.
+var quickXorTests = []struct {
+    name string
+    in   string
+    want string
+}{
+    {"empty", "", "AAAAAAAAAAAAAAAAAAAAAAAAAAA="},
+    {"one byte", "a", "YQAAAAAAAAAAAAAAAQAAAAAAAAA="},
+    {"short", "abc", "YRDDGAAAAAAAAAAAAwAAAAAAAAA="},
+    // 344 bits, so bytes wrap around the 160-bit buffer.
+    {"past one width", "The quick brown fox jumps over the lazy dog", "bMSlbysmxJL6S75XwfMcQZOpcr4="},
+    {"many widths", strings.Repeat("0123456789abcdef", 64), "69JyGiRcldK8tjuClYcOXea70hc="},
+}
+
+func TestQuickXorHash(t *testing.T) {
+    for _, tt := range quickXorTests {
+        h := newQuickXorHash()
+        h.Write([]byte(tt.in))
+        if got := base64.StdEncoding.EncodeToString(h.Sum(nil)); got != tt.want {
+            t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+        }
+
+        // Writing in pieces must not change the result.
+        h.Reset()
+        for i := 0; i < len(tt.in); i++ {
+            h.Write([]byte{tt.in[i]})
+        }
+        if got := base64.StdEncoding.EncodeToString(h.Sum(nil)); got != tt.want {
+            t.Errorf("%s, byte by byte: got %s, want %s", tt.name, got, tt.want)
+        }
+    }
+}
+
+func TestQuickXorHashEncoding(t *testing.T) {
+    h, err := newHasher("quickxor")
+    if err != nil {
+        t.Fatal(err)
+    }
+    h.Write([]byte("abc"))
+    if got := encodeHash("quickxor", h.Sum(nil)); got != "YRDDGAAAAAAAAAAAAwAAAAAAAAA=" {
+        t.Errorf("encodeHash: got %s", got)
+    }
+    if !sameHash("quickxor", "YRDDGAAAAAAAAAAAAwAAAAAAAAA=", "YRDDGAAAAAAAAAAAAwAAAAAAAAA=") {
+        t.Error("sameHash: identical quickXorHash values differ")
+    }
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "strings"
+)
+
+type removeOptions struct {
+    Recursive bool
+    DryRun    bool
+    Permanent bool
+    Yes       bool
+}
+
+// Remove deletes every item matched by targets. Items go to the recycle bin
+// unless Permanent is set and the drive supports permanentDelete.
+func Remove(ctx context.Context, targets []string, opts removeOptions) error {
+    failed := 0
+    warned := false
+    for _, target := range targets {
+        entries, err := expandRemote(ctx, target)
+        if err != nil {
+            fmt.Println("❌", target+":", err)
+            failed++
+            continue
+        }
+        for _, entry := range entries {
+            if opts.Permanent && !supportsPermanentDelete(entry.Item) && !warned {
+                fmt.Println("⚠️ Permanent delete is not supported on personal drives, using the recycle bin.")
+                warned = true
+            }
+            if err := removeItem(ctx, entry, opts); err != nil {
+                fmt.Println("❌", entry.Path+":", err)
+                failed++
+            }
+        }
+    }
+
+    if failed > 0 {
+        return fmt.Errorf("%d item(s) could not be removed", failed)
+    }
+    return nil
+}
+
+func removeItem(ctx context.Context, entry remoteEntry, opts removeOptions) error {
+    if entry.Path == "/" {
+        return fmt.Errorf("refusing to remove the drive root")
+    }
+
+    if entry.Item.Folder != nil {
+        if !opts.Recursive {
+            return fmt.Errorf("is a folder (use -r)")
+        }
+        if !opts.DryRun && !opts.Yes {
+            question := fmt.Sprintf("Delete folder %s and its %d item(s)?", entry.Path, entry.Item.Folder.ChildCount)
+            if !confirm(question) {
+                fmt.Println("⏭️ Skipped:", entry.Path)
+                return nil
+            }
+        }
+    }
+
+    permanent := opts.Permanent && supportsPermanentDelete(entry.Item)
+    if opts.DryRun {
+        if permanent {
+            fmt.Println("🔍 Would permanently delete:", entry.Path)
+        } else {
+            fmt.Println("🔍 Would delete:", entry.Path)
+        }
+        return nil
+    }
+
+    if permanent {
+        if err := graphJSON(ctx, "POST", itemIDURL(entry.Item)+"/permanentDelete", nil, nil); err != nil {
+            return err
+        }
+        fmt.Println("🗑️ Permanently deleted:", entry.Path)
+        return nil
+    }
+
+    if err := graphJSON(ctx, "DELETE", itemIDURL(entry.Item), nil, nil); err != nil {
+        return err
+    }
+    fmt.Println("🗑️ Moved to recycle bin:", entry.Path)
+    return nil
+}
+
+// supportsPermanentDelete reports whether the item lives on a drive type that
+// accepts permanentDelete. Personal OneDrive does not.
+func supportsPermanentDelete(item DriveItem) bool {
+    if item.ParentReference == nil {
+        return false
+    }
+    return item.ParentReference.DriveType == "business" || item.ParentReference.DriveType == "documentLibrary"
+}
+
+func confirm(question string) bool {
+    fmt.Print(question + " [y/N]: ")
+    var answer string
+    fmt.Scanln(&answer)
+    answer = strings.ToLower(strings.TrimSpace(answer))
+    return answer == "y" || answer == "yes"
+}
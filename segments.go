@@ -0,0 +1,163 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "os"
+    "sync"
+    "sync/atomic"
+    "time"
+)
+
+// errRangeIgnored means the server answered a range request with the whole
+// file. Some servers do; the download then falls back to a single stream.
+var errRangeIgnored = errors.New("server ignored the requested range")
+
+// Files are only split when every segment gets at least this much; below
+// that the extra connections cost more than they gain.
+const minSegmentSize = 8 * 1024 * 1024
+
+// segmentCount is how many ranges a file of size bytes is fetched in when
+// up to want are allowed.
+func segmentCount(size int64, want int) int {
+    if n := size / minSegmentSize; int64(want) > n {
+        want = int(n)
+    }
+    if want < 1 {
+        return 1
+    }
+    return want
+}
+
+// offsetWriter writes sequentially into an io.WriterAt from pos onwards.
+type offsetWriter struct {
+    w   io.WriterAt
+    pos int64
+}
+
+func (o *offsetWriter) Write(p []byte) (int, error) {
+    n, err := o.w.WriteAt(p, o.pos)
+    o.pos += int64(n)
+    return n, err
+}
+
+// downloadSegments fetches item into a preallocated partial file as
+// concurrent byte ranges. Holes make such a file impossible to resume by
+// size, so it is never recorded as a resumable partial. If the server does
+// not honour ranges, the file is downloaded in one stream instead.
+func downloadSegments(ctx context.Context, item *DriveItem, partial string, progress *transferProgress, segments int, verify string) (int64, error) {
+    discardPartial(partial)
+    out, err := os.OpenFile(partial, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+    if err != nil {
+        return 0, err
+    }
+    if err := out.Truncate(item.Size); err != nil {
+        out.Close()
+        return 0, err
+    }
+
+    segCtx, cancel := context.WithCancel(ctx)
+    defer cancel()
+    segSize := (item.Size + int64(segments) - 1) / int64(segments)
+    errs := make([]error, segments)
+    var fetched int64
+    var wg sync.WaitGroup
+    for i := 0; i < segments; i++ {
+        start := int64(i) * segSize
+        end := start + segSize - 1
+        if end >= item.Size {
+            end = item.Size - 1
+        }
+        wg.Add(1)
+        go func(i int, start, end int64) {
+            defer wg.Done()
+            n, err := fetchSegment(segCtx, item, out, start, end, progress)
+            atomic.AddInt64(&fetched, n)
+            if errors.Is(err, errRangeIgnored) {
+                // The other segments would fail the same way.
+                cancel()
+            }
+            errs[i] = err
+        }(i, start, end)
+    }
+    wg.Wait()
+
+    err = out.Close()
+    for _, segErr := range errs {
+        if errors.Is(segErr, errRangeIgnored) && ctx.Err() == nil {
+            printLine("⚠️ %s: %v, downloading in one stream", item.Name, segErr)
+            progress.addBytes(-fetched)
+            discardPartial(partial)
+            return downloadOnce(ctx, item, partial, progress, verify)
+        }
+    }
+    for _, segErr := range errs {
+        if segErr != nil {
+            err = segErr
+            break
+        }
+    }
+    if err != nil {
+        discardPartial(partial)
+        return item.Size, err
+    }
+
+    algo, sum := "", ""
+    if verify == "hash" {
+        if algo = verifyAlgorithm(*item); algo != "" {
+            if sum, err = hashLocalFile(partial, algo); err != nil {
+                return item.Size, err
+            }
+        }
+    }
+    if err := checkTransfer(*item, item.Size, algo, sum, verify); err != nil {
+        discardPartial(partial)
+        return item.Size, err
+    }
+    return item.Size, nil
+}
+
+// fetchSegment downloads bytes start-end (inclusive) into out, continuing
+// from where a failed attempt stopped. It returns how many bytes it wrote.
+func fetchSegment(ctx context.Context, item *DriveItem, out io.WriterAt, start, end int64, progress *transferProgress) (int64, error) {
+    pos := start
+    for attempt := 1; ; attempt++ {
+        n, err := fetchRange(ctx, item, out, pos, end, progress)
+        pos += n
+        if err == nil && pos <= end {
+            err = io.ErrUnexpectedEOF
+        }
+        if err == nil {
+            return pos - start, nil
+        }
+        if attempt >= maxChunkAttempts || !isRetryable(err) || errors.Is(err, errRangeIgnored) {
+            return pos - start, fmt.Errorf("segment at offset %d: %w", start, err)
+        }
+
+        printLine("⚠️ Segment at offset %d failed at %d (%v), retrying...", start, pos, err)
+        if err := sleepContext(ctx, time.Duration(attempt*attempt)*time.Second); err != nil {
+            return pos - start, err
+        }
+    }
+}
+
+func fetchRange(ctx context.Context, item *DriveItem, out io.WriterAt, pos, end int64, progress *transferProgress) (int64, error) {
+    resp, err := getContent(ctx, item, fmt.Sprintf("bytes=%d-%d", pos, end))
+    if err != nil {
+        return 0, err
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode >= 300 {
+        return 0, readGraphError(resp)
+    }
+    if resp.StatusCode != http.StatusPartialContent && pos > 0 {
+        // A whole body from byte 0 still starts where this range does.
+        return 0, errRangeIgnored
+    }
+    body := throttle(io.LimitReader(resp.Body, end-pos+1))
+    return io.Copy(&offsetWriter{w: out, pos: pos}, &countingReader{r: body, progress: progress})
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "math/rand"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+)
+
+// usePartialsFile keeps a test's partial download index out of the user's
+// config directory.
+func usePartialsFile(t *testing.T) {
+    old := PartialsFile
+    PartialsFile = filepath.Join(t.TempDir(), "partials.json")
+    t.Cleanup(func() { PartialsFile = old })
+}
+
+func TestSegmentCount(t *testing.T) {
+    tests := []struct {
+        size    int64
+        allowed int
+        want    int
+    }{
+        {0, 4, 1},
+        {minSegmentSize - 1, 4, 1},
+        {2 * minSegmentSize, 4, 2},
+        {100 * minSegmentSize, 4, 4},
+        {100 * minSegmentSize, 0, 1},
+    }
+    for _, tt := range tests {
+        if got := segmentCount(tt.size, tt.allowed); got != tt.want {
+            t.Errorf("segmentCount(%d, %d) = %d, want %d", tt.size, tt.allowed, got, tt.want)
+        }
+    }
+}
+
+func TestDownloadSegments(t *testing.T) {
+    data := make([]byte, 3*minSegmentSize+12345)
+    rand.New(rand.NewSource(1)).Read(data)
+
+    for _, honourRange := range []bool{true, false} {
+        usePartialsFile(t)
+        srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            if !honourRange {
+                r.Header.Del("Range")
+            }
+            http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+        }))
+
+        item := &DriveItem{Name: "big.bin", Size: int64(len(data)), DownloadURL: srv.URL, ETag: "1"}
+        partial := filepath.Join(t.TempDir(), "big.bin"+partialSuffix)
+        progress := startProgress(item.Size, 1)
+        n, err := downloadSegments(context.Background(), item, partial, progress, 3, "size")
+        progress.stop()
+        srv.Close()
+        if err != nil {
+            t.Fatalf("honourRange=%v: %v", honourRange, err)
+        }
+        if n != item.Size || progress.bytes != item.Size {
+            t.Errorf("honourRange=%v: returned %d, progress %d, want %d", honourRange, n, progress.bytes, item.Size)
+        }
+        got, _ := os.ReadFile(partial)
+        if !bytes.Equal(got, data) {
+            t.Errorf("honourRange=%v: downloaded content differs", honourRange)
+        }
+    }
+}
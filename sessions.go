@@ -0,0 +1,279 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+)
+
+// SessionsFile is absolute so that --resume finds it from any directory.
+var SessionsFile = statePath("upload_sessions.json")
+
+// statePath places one of the tool's state files in the user's config
+// directory, falling back to the working directory if there is none.
+func statePath(name string) string {
+    dir, err := os.UserConfigDir()
+    if err != nil {
+        abs, _ := filepath.Abs(name)
+        return abs
+    }
+    return filepath.Join(dir, "onedrivecli", name)
+}
+
+// writeState writes a state file, creating its directory if needed.
+func writeState(file string, data []byte, perm os.FileMode) error {
+    if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+        return err
+    }
+    return os.WriteFile(file, data, perm)
+}
+
+// uploadSession is an upload in progress, persisted so that a later run can
+// continue it. Size and ModTime fingerprint the local file; if either has
+// changed the session is discarded rather than resumed.
+type uploadSession struct {
+    UploadURL          string    `json:"uploadUrl"`
+    ExpirationDateTime time.Time `json:"expirationDateTime"`
+    Remote             string    `json:"remote"`
+    Local              string    `json:"local"`
+    Size               int64     `json:"size"`
+    ModTime            time.Time `json:"modTime"`
+}
+
+var sessionsMu sync.Mutex
+
+func (s uploadSession) expired() bool {
+    return !s.ExpirationDateTime.IsZero() && time.Now().After(s.ExpirationDateTime)
+}
+
+func (s uploadSession) matches(local string, info os.FileInfo) bool {
+    abs, _ := filepath.Abs(local)
+    return s.Local == abs && s.Size == info.Size() && s.ModTime.Equal(info.ModTime())
+}
+
+func loadSessions() (map[string]uploadSession, error) {
+    sessions := map[string]uploadSession{}
+    data, err := os.ReadFile(SessionsFile)
+    if os.IsNotExist(err) {
+        return sessions, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    if err := json.Unmarshal(data, &sessions); err != nil {
+        return nil, fmt.Errorf("%s: %w", SessionsFile, err)
+    }
+    return sessions, nil
+}
+
+func saveSessions(sessions map[string]uploadSession) error {
+    if len(sessions) == 0 {
+        err := os.Remove(SessionsFile)
+        if os.IsNotExist(err) {
+            return nil
+        }
+        return err
+    }
+    data, err := json.MarshalIndent(sessions, "", "  ")
+    if err != nil {
+        return err
+    }
+    return writeState(SessionsFile, data, 0600)
+}
+
+func findSession(remote string) (uploadSession, bool) {
+    sessionsMu.Lock()
+    defer sessionsMu.Unlock()
+    sessions, err := loadSessions()
+    if err != nil {
+        return uploadSession{}, false
+    }
+    s, ok := sessions[remote]
+    return s, ok
+}
+
+func rememberSession(s uploadSession) {
+    sessionsMu.Lock()
+    defer sessionsMu.Unlock()
+    sessions, err := loadSessions()
+    if err != nil {
+        fmt.Println("⚠️ Could not load upload sessions:", err)
+        return
+    }
+    sessions[s.Remote] = s
+    if err := saveSessions(sessions); err != nil {
+        fmt.Println("⚠️ Could not save upload session:", err)
+    }
+}
+
+func forgetSession(remote string) {
+    sessionsMu.Lock()
+    defer sessionsMu.Unlock()
+    sessions, err := loadSessions()
+    if err != nil {
+        return
+    }
+    if _, ok := sessions[remote]; !ok {
+        return
+    }
+    delete(sessions, remote)
+    saveSessions(sessions)
+}
+
+// resumeSession returns the saved session for remote and the offset to
+// continue from. Sessions that no longer apply are forgotten.
+func resumeSession(ctx context.Context, remote, local string, info os.FileInfo) (uploadSession, int64, bool) {
+    s, ok := findSession(remote)
+    if !ok {
+        return uploadSession{}, 0, false
+    }
+    if s.matches(local, info) && !s.expired() {
+        if offset, err := nextExpectedOffset(ctx, s.UploadURL); err == nil {
+            return s, offset, true
+        }
+    }
+    forgetSession(remote)
+    return uploadSession{}, 0, false
+}
+
+func sortedSessions() ([]uploadSession, error) {
+    sessionsMu.Lock()
+    defer sessionsMu.Unlock()
+    sessions, err := loadSessions()
+    if err != nil {
+        return nil, err
+    }
+    list := make([]uploadSession, 0, len(sessions))
+    for _, s := range sessions {
+        list = append(list, s)
+    }
+    sort.Slice(list, func(i, j int) bool { return list[i].Remote < list[j].Remote })
+    return list, nil
+}
+
+// ResumeUploads continues every saved upload session whose local file is
+// unchanged. opts apply as they would to a new upload, so --on-conflict and
+// --if-newer see what has meanwhile appeared at the destination.
+func ResumeUploads(ctx context.Context, opts uploadOptions) error {
+    if err := opts.validate(); err != nil {
+        return err
+    }
+    list, err := sortedSessions()
+    if err != nil {
+        return err
+    }
+    if len(list) == 0 {
+        fmt.Println("No pending uploads.")
+        return nil
+    }
+
+    var total int64
+    for _, s := range list {
+        total += s.Size
+    }
+
+    run := &uploadRun{opts: opts, planned: len(list)}
+    run.progress = startProgress(total, int64(len(list)))
+    failed := 0
+    for _, s := range list {
+        if ctx.Err() != nil {
+            break
+        }
+        existing, err := lookupExisting(ctx, s.Remote)
+        if err == nil {
+            err = run.uploadFile(ctx, s.Remote, s.Local, existing)
+        }
+        if err != nil && ctx.Err() == nil {
+            printLine("❌ %s: %v", s.Remote, err)
+            failed++
+        }
+        run.progress.fileDone()
+    }
+    run.progress.stop()
+    if err := run.finish(ctx, nil); err != nil {
+        return err
+    }
+    if failed > 0 {
+        return fmt.Errorf("%d upload(s) could not be resumed", failed)
+    }
+    return nil
+}
+
+// ListUploads prints saved upload sessions and how far each has got.
+func ListUploads(ctx context.Context) error {
+    list, err := sortedSessions()
+    if err != nil {
+        return err
+    }
+    if len(list) == 0 {
+        fmt.Println("No pending uploads.")
+        return nil
+    }
+
+    for _, s := range list {
+        state := "expired"
+        if !s.expired() {
+            offset, err := nextExpectedOffset(ctx, s.UploadURL)
+            if err != nil {
+                state = "unavailable"
+            } else {
+                state = fmt.Sprintf("%d/%d MB, expires %s",
+                    offset/1024/1024, s.Size/1024/1024, s.ExpirationDateTime.Local().Format("2006-01-02 15:04"))
+            }
+        }
+        fmt.Printf("⏸️ %s <- %s (%s)\n", s.Remote, s.Local, state)
+    }
+    return nil
+}
+
+// CancelUploads deletes the named sessions (or all of them) on the server and
+// forgets them locally.
+func CancelUploads(ctx context.Context, remotes []string, all bool) error {
+    list, err := sortedSessions()
+    if err != nil {
+        return err
+    }
+
+    wanted := map[string]bool{}
+    for _, r := range remotes {
+        wanted["/"+strings.TrimLeft(r, "/")] = true
+    }
+
+    for _, s := range list {
+        if !all && !wanted[s.Remote] {
+            continue
+        }
+        delete(wanted, s.Remote)
+        if !s.expired() {
+            if err := deleteSession(ctx, s.UploadURL); err != nil {
+                fmt.Println("⚠️ Could not cancel", s.Remote+":", err)
+            }
+        }
+        forgetSession(s.Remote)
+        fmt.Println("🗑️ Cancelled:", s.Remote)
+    }
+
+    for r := range wanted {
+        fmt.Println("⚠️ No pending upload for", r)
+    }
+    return nil
+}
+
+// deleteSession cancels an upload session on the server, discarding the
+// ranges uploaded so far.
+func deleteSession(ctx context.Context, uploadURL string) error {
+    req, _ := http.NewRequestWithContext(ctx, "DELETE", uploadURL, nil)
+    resp, err := http.DefaultClient.Do(req)
+    if err != nil {
+        return err
+    }
+    resp.Body.Close()
+    return nil
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+    "os"
+    "path/filepath"
+    "runtime"
+    "testing"
+)
+
+func TestStatePath(t *testing.T) {
+    if !filepath.IsAbs(SessionsFile) {
+        t.Errorf("SessionsFile %q is relative to the working directory", SessionsFile)
+    }
+    if runtime.GOOS != "linux" {
+        t.Skip("XDG_CONFIG_HOME only applies on Linux")
+    }
+
+    config := t.TempDir()
+    t.Setenv("XDG_CONFIG_HOME", config)
+    file := statePath("state.json")
+    if want := filepath.Join(config, "onedrivecli", "state.json"); file != want {
+        t.Fatalf("statePath = %q, want %q", file, want)
+    }
+    if err := writeState(file, []byte("{}"), 0600); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := os.Stat(file); err != nil {
+        t.Error(err)
+    }
+}
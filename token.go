@@ -7,6 +7,8 @@ import (
     "net/http"
     "net/url"
     "os"
+    "path/filepath"
+    "sync"
     "time"
 )
 
@@ -26,7 +28,9 @@ func LoadToken() (StoredToken, error) {
     }
     defer file.Close()
     var token StoredToken
-    json.NewDecoder(file).Decode(&token)
+    if err := json.NewDecoder(file).Decode(&token); err != nil {
+        return StoredToken{}, fmt.Errorf("%s: %w", TokenFile, err)
+    }
     return token, nil
 }
 
@@ -40,28 +44,80 @@ func SaveToken(token TokenResponse) error {
         ObtainedAt:   time.Now().Unix(),
     }
 
-    f, err := os.Create(TokenFile)
+    // Write a temporary file and rename it over the old one, so that a
+    // reader never sees a half-written token.
+    f, err := os.CreateTemp(filepath.Dir(TokenFile), filepath.Base(TokenFile)+".*")
     if err != nil {
         return err
     }
-    defer f.Close()
-    return json.NewEncoder(f).Encode(stored)
+    if err := json.NewEncoder(f).Encode(stored); err != nil {
+        f.Close()
+        os.Remove(f.Name())
+        return err
+    }
+    if err := f.Close(); err != nil {
+        os.Remove(f.Name())
+        return err
+    }
+    return os.Rename(f.Name(), TokenFile)
+}
+
+// The token is read once and then kept in memory. tokenMu makes parallel
+// workers wait for a refresh in progress rather than start their own.
+var (
+    tokenMu     sync.Mutex
+    cachedToken *StoredToken
+)
+
+func (t StoredToken) expired() bool {
+    return time.Now().Unix() > t.ObtainedAt+int64(t.ExpiresIn)-30
 }
 
+// GetAccessToken returns a valid access token, refreshing it if needed. It
+// reports problems on stderr, since stdout may be carrying file data for
+// cat or download --archive.
 func GetAccessToken() string {
-    token, err := LoadToken()
-    if err != nil {
-        fmt.Println("❌ No token found, please run `onedrivecli auth` first.")
-        os.Exit(1)
+    tokenMu.Lock()
+    defer tokenMu.Unlock()
+    if cachedToken == nil {
+        token, err := LoadToken()
+        if err != nil {
+            fmt.Fprintln(os.Stderr, "❌ No token found, please run `onedrivecli auth` first.")
+            os.Exit(1)
+        }
+        cachedToken = &token
+    }
+
+    if cachedToken.expired() {
+        fmt.Fprintln(os.Stderr, "🔄 Access token expired, refreshing...")
+        token := RefreshAccessToken(cachedToken.RefreshToken)
+        cachedToken = &token
     }
+    return cachedToken.AccessToken
+}
 
-    expiresAt := token.ObtainedAt + int64(token.ExpiresIn) - 30
-    if time.Now().Unix() > expiresAt {
-        fmt.Println("🔄 Access token expired, refreshing...")
-        token = RefreshAccessToken(token.RefreshToken)
+// refreshRejectedToken returns a token to retry with after the server
+// rejected rejected. The clock alone cannot be trusted to say a token is
+// stale, so this always refreshes, unless another worker already has.
+func refreshRejectedToken(rejected string) string {
+    tokenMu.Lock()
+    defer tokenMu.Unlock()
+    if cachedToken != nil && cachedToken.AccessToken != rejected {
+        return cachedToken.AccessToken
+    }
+    if cachedToken == nil {
+        token, err := LoadToken()
+        if err != nil {
+            fmt.Fprintln(os.Stderr, "❌ No token found, please run `onedrivecli auth` first.")
+            os.Exit(1)
+        }
+        cachedToken = &token
     }
 
-    return token.AccessToken
+    fmt.Fprintln(os.Stderr, "🔄 Access token rejected, refreshing...")
+    token := RefreshAccessToken(cachedToken.RefreshToken)
+    cachedToken = &token
+    return cachedToken.AccessToken
 }
 
 func RefreshAccessToken(refreshToken string) StoredToken {
@@ -73,7 +129,7 @@ func RefreshAccessToken(refreshToken string) StoredToken {
 
     resp, err := http.PostForm(tokenURL, data)
     if err != nil {
-        fmt.Println("❌ HTTP Request Failed:", err)
+        fmt.Fprintln(os.Stderr, "❌ HTTP Request Failed:", err)
         os.Exit(1)
     }
     defer resp.Body.Close()
@@ -84,11 +140,13 @@ func RefreshAccessToken(refreshToken string) StoredToken {
     json.Unmarshal(body, &tokenResp)
 
     if tokenResp.AccessToken == "" {
-        fmt.Println("❌ Failed to refresh token. Please run `onedrivecli auth` again.")
+        fmt.Fprintln(os.Stderr, "❌ Failed to refresh token. Please run `onedrivecli auth` again.")
         os.Exit(1)
     }
 
-    SaveToken(tokenResp)
+    if err := SaveToken(tokenResp); err != nil {
+        fmt.Fprintln(os.Stderr, "⚠️ Could not save the refreshed token:", err)
+    }
 
     return StoredToken{
         AccessToken:  tokenResp.AccessToken,
@@ -0,0 +1,75 @@
+package main
+
+import (
+    "os"
+    "testing"
+    "time"
+)
+
+// inTempDir runs the rest of a test in a fresh directory, where relative
+// files such as TokenFile end up.
+func inTempDir(t *testing.T) string {
+    dir := t.TempDir()
+    old, err := os.Getwd()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := os.Chdir(dir); err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { os.Chdir(old) })
+    return dir
+}
+
+func TestSaveAndLoadToken(t *testing.T) {
+    dir := inTempDir(t)
+    if err := SaveToken(TokenResponse{AccessToken: "access", RefreshToken: "refresh", ExpiresIn: 3600}); err != nil {
+        t.Fatal(err)
+    }
+    token, err := LoadToken()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if token.AccessToken != "access" || token.RefreshToken != "refresh" || token.expired() {
+        t.Errorf("loaded %+v", token)
+    }
+
+    // Only the token itself is left behind.
+    entries, _ := os.ReadDir(dir)
+    if len(entries) != 1 || entries[0].Name() != TokenFile {
+        t.Errorf("directory holds %v", entries)
+    }
+}
+
+func TestLoadTruncatedToken(t *testing.T) {
+    inTempDir(t)
+    if err := os.WriteFile(TokenFile, []byte(`{"access_token": "acc`), 0600); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := LoadToken(); err == nil {
+        t.Error("LoadToken accepted a truncated file")
+    }
+}
+
+func TestGetAccessTokenCached(t *testing.T) {
+    inTempDir(t)
+    old := cachedToken
+    defer func() { cachedToken = old }()
+
+    // No token file: the cached token must be used without reading it.
+    cachedToken = &StoredToken{AccessToken: "cached", ExpiresIn: 3600, ObtainedAt: time.Now().Unix()}
+    if got := GetAccessToken(); got != "cached" {
+        t.Errorf("GetAccessToken = %q, want the cached token", got)
+    }
+}
+
+func TestRefreshRejectedTokenAlreadyRefreshed(t *testing.T) {
+    old := cachedToken
+    defer func() { cachedToken = old }()
+
+    // Another worker refreshed after this one's request was rejected.
+    cachedToken = &StoredToken{AccessToken: "new", ExpiresIn: 3600, ObtainedAt: time.Now().Unix()}
+    if got := refreshRejectedToken("old"); got != "new" {
+        t.Errorf("refreshRejectedToken = %q, want the newer cached token", got)
+    }
+}
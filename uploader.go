@@ -2,58 +2,452 @@ package main
 
 import (
     "bytes"
+    "context"
     "encoding/json"
+    "errors"
     "fmt"
     "io"
-    "log"
     "net/http"
+    "net/url"
     "os"
+    "path"
     "path/filepath"
+    "sort"
     "strings"
     "sync"
-    "sync/atomic"
     "time"
 )
 
 const (
-    chunkSize = 10 * 1024 * 1024 // 10MB
-    workers   = 4
+    chunkSize        = 10 * 1024 * 1024 // 10MB, a multiple of the required 320 KiB
+    maxChunkAttempts = 5
+
+    // Graph accepts a plain PUT to /content for files up to 4 MB.
+    simpleUploadLimit = 4 * 1024 * 1024
 )
 
-func StartUpload(remote, local string) error {
+type uploadOptions struct {
+    OnConflict string // replace, rename, fail or skip
+    IfNewer    bool   // only replace remote files older than the local one
+    IfChanged  bool   // only replace remote files whose size or hash differ
+    Workers    int    // files uploaded in parallel within a folder
+    Sanitize   bool   // replace characters OneDrive rejects with lookalikes
+
+    OnCollision string // fail, rename or skip when two local names map to one remote name
+    NoNormalize bool   // keep names as they are instead of normalizing to NFC
+    NoTimes     bool   // let OneDrive stamp files with the upload time
+    Verify      string // off, size or hash: how uploads are checked afterwards
+    OnInterrupt string // keep or discard upload sessions when interrupted
+    Filters     filterOptions
+}
+
+func (o uploadOptions) validate() error {
+    switch o.OnConflict {
+    case "replace", "rename", "fail", "skip":
+    default:
+        return fmt.Errorf("invalid --on-conflict %q (want replace, rename, fail or skip)", o.OnConflict)
+    }
+    switch o.OnCollision {
+    case "fail", "rename", "skip":
+    default:
+        return fmt.Errorf("invalid --on-collision %q (want fail, rename or skip)", o.OnCollision)
+    }
+    if err := validInterrupt(o.OnInterrupt); err != nil {
+        return err
+    }
+    return validVerify(o.Verify)
+}
+
+// graphConflict is the conflictBehavior sent to Graph. Skipping is decided
+// before the upload; "fail" then guards against the file appearing meanwhile.
+func (o uploadOptions) graphConflict() string {
+    if o.OnConflict == "skip" {
+        return "fail"
+    }
+    return o.OnConflict
+}
+
+// skipReason decides whether a file should be left alone given what already
+// exists at the destination. An empty reason means upload it.
+func (o uploadOptions) skipReason(local string, info os.FileInfo, existing *DriveItem) (string, error) {
+    if existing == nil {
+        return "", nil
+    }
+    if o.OnConflict == "skip" {
+        return "already exists", nil
+    }
+    // OneDrive keeps whole seconds, so compare at that precision or a file
+    // uploaded with its timestamp preserved would always look newer.
+    if o.IfNewer && !info.ModTime().Truncate(time.Second).After(existing.modTime()) {
+        return "remote is not older", nil
+    }
+    if o.IfChanged && existing.File != nil {
+        same, err := sameContent(local, info, existing)
+        if err != nil {
+            return "", err
+        }
+        if same {
+            return "unchanged", nil
+        }
+    }
+    return "", nil
+}
+
+// uploadReport collects what happened to each file for the final summary.
+type uploadReport struct {
+    mu       sync.Mutex
+    Uploaded []string
+    Replaced []string
+    Renamed  []string
+    Skipped  []string
+}
+
+func (r *uploadReport) add(list *[]string, entry string) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    *list = append(*list, entry)
+}
+
+func (r *uploadReport) completed() int {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    return len(r.Uploaded) + len(r.Replaced) + len(r.Renamed) + len(r.Skipped)
+}
+
+func (r *uploadReport) print() {
+    fmt.Printf("\n📊 %d uploaded, %d replaced, %d renamed, %d skipped\n",
+        len(r.Uploaded), len(r.Replaced), len(r.Renamed), len(r.Skipped))
+    for _, s := range r.Replaced {
+        fmt.Println("♻️ Replaced:", s)
+    }
+    for _, s := range r.Renamed {
+        fmt.Println("✏️ Renamed:", s)
+    }
+    for _, s := range r.Skipped {
+        fmt.Println("⏭️ Skipped:", s)
+    }
+}
+
+// uploadRun is the state shared by every file in one upload command.
+type uploadRun struct {
+    opts     uploadOptions
+    filter   *pathFilter
+    report   uploadReport
+    progress *transferProgress
+    planned  int // files this run set out to upload
+}
+
+// StartUpload uploads a local file or folder. A local path of "-" reads
+// the content from stdin.
+func StartUpload(ctx context.Context, remote, local string, opts uploadOptions) error {
+    if err := opts.validate(); err != nil {
+        return err
+    }
+    remote = "/" + strings.TrimLeft(remote, "/")
+    if !opts.NoNormalize {
+        remote = normalizeName(remote)
+    }
+    run := &uploadRun{opts: opts, planned: 1}
+
+    if problem := remotePathProblem(remote); problem != "" {
+        if !opts.Sanitize || nameProblem(path.Base(remote)) == "" {
+            return fmt.Errorf("%s: %s", remote, problem)
+        }
+        sanitized := path.Join(path.Dir(remote), sanitizeName(path.Base(remote)))
+        fmt.Printf("✏️ Sanitized: %s -> %s\n", remote, sanitized)
+        if err := recordSanitized(map[string]string{sanitized: remote}); err != nil {
+            return err
+        }
+        remote = sanitized
+    }
+
+    if local == "-" {
+        run.progress = startProgress(0, 1)
+        err := run.uploadStream(ctx, remote, os.Stdin)
+        run.progress.stop()
+        return run.finish(ctx, err)
+    }
     if local == "." {
         cwd, _ := os.Getwd()
         local = cwd
     }
+    local = filepath.Clean(local)
 
     info, err := os.Stat(local)
     if err != nil {
         return err
     }
 
-    token := GetAccessToken()
     if info.IsDir() {
-        return uploadFolder(remote, local, token)
+        if run.filter, err = newPathFilter(opts.Filters, local); err != nil {
+            return err
+        }
+        err = run.uploadFolder(ctx, remote, local)
+    } else {
+        var existing *DriveItem
+        existing, err = lookupExisting(ctx, remote)
+        if err == nil {
+            run.progress = startProgress(info.Size(), 1)
+            err = run.uploadFile(ctx, remote, local, existing)
+            run.progress.stop()
+        }
     }
-    return uploadFile(remote, local, token)
+    return run.finish(ctx, err)
 }
 
-func uploadFolder(remote, local, token string) error {
-    return filepath.Walk(local, func(path string, info os.FileInfo, err error) error {
+// finish prints the report and, if the run was interrupted, how far it got.
+func (run *uploadRun) finish(ctx context.Context, err error) error {
+    run.report.print()
+    if ctx.Err() != nil {
+        fmt.Printf("⏹️ Interrupted after %d of %d files\n", run.report.completed(), run.planned)
+        return errInterrupted
+    }
+    return err
+}
+
+// lookupExisting returns the item at remote, or nil if there is none.
+func lookupExisting(ctx context.Context, remote string) (*DriveItem, error) {
+    item, err := getItem(ctx, remote)
+    if isNotFound(err) {
+        return nil, nil
+    }
+    return item, err
+}
+
+type uploadJob struct {
+    remote   string
+    local    string
+    size     int64
+    existing *DriveItem
+}
+
+// uploadPlan is what a scan of the local tree found, before any request
+// is made.
+type uploadPlan struct {
+    dirs       []string
+    jobs       []uploadJob
+    totalBytes int64
+    problems   []string
+    collisions []string
+    renames    map[string]string
+    excluded   int
+}
+
+// planUpload walks local and assigns each folder and file its remote path
+// below remote, checking every name on the way.
+func (run *uploadRun) planUpload(remote, local string) (*uploadPlan, error) {
+    // Walk passes paths built from local as given, while filepath.Dir
+    // returns them cleaned; keys in remoteDirs must agree with both.
+    local = filepath.Clean(local)
+    plan := &uploadPlan{renames: map[string]string{}}
+
+    // Remote path assigned to each local folder, and which local path has
+    // claimed each remote name so far.
+    remoteDirs := map[string]string{}
+    taken := map[string]string{}
+
+    err := filepath.Walk(local, func(localPath string, info os.FileInfo, err error) error {
         if err != nil {
             return err
         }
+        relPath, _ := filepath.Rel(local, localPath)
+        rel := filepath.ToSlash(relPath)
+        if run.filter.excluded(rel, info.IsDir()) {
+            plan.excluded++
+            if info.IsDir() {
+                return filepath.SkipDir
+            }
+            return nil
+        }
+
+        oneDrivePath := remote
+        if rel != "." {
+            parent := remoteDirs[filepath.Dir(localPath)]
+            name := info.Name()
+            if !run.opts.NoNormalize {
+                name = normalizeName(name)
+            }
+            sanitized := false
+            if run.opts.Sanitize {
+                if clean := sanitizeName(name); clean != name {
+                    name, sanitized = clean, true
+                }
+            }
+            oneDrivePath = path.Join(parent, name)
+
+            if other, clash := taken[collisionKey(oneDrivePath)]; clash {
+                switch run.opts.OnCollision {
+                case "skip":
+                    run.report.add(&run.report.Skipped, fmt.Sprintf("%s (same name as %s)", localPath, other))
+                    if info.IsDir() {
+                        return filepath.SkipDir
+                    }
+                    return nil
+                case "rename":
+                    oneDrivePath = path.Join(parent, freeName(parent, name, taken))
+                    run.report.add(&run.report.Renamed, fmt.Sprintf("%s -> %s (same name as %s)", localPath, oneDrivePath, other))
+                default:
+                    plan.collisions = append(plan.collisions, fmt.Sprintf("%s and %s both map to %s", other, localPath, oneDrivePath))
+                }
+            }
+            taken[collisionKey(oneDrivePath)] = localPath
+            if sanitized {
+                plan.renames[oneDrivePath] = localPath
+            }
+
+            if problem := remotePathProblem(oneDrivePath); problem != "" {
+                plan.problems = append(plan.problems, fmt.Sprintf("%s: %s", localPath, problem))
+            }
+        }
+
         if info.IsDir() {
+            if rel != "." {
+                // Nested ignore files apply to their own subtree.
+                if err := run.filter.loadIgnoreFile(filepath.Join(localPath, IgnoreFile), rel); err != nil {
+                    return err
+                }
+            }
+            remoteDirs[localPath] = oneDrivePath
+            plan.dirs = append(plan.dirs, oneDrivePath)
             return nil
         }
 
-        relPath, _ := filepath.Rel(local, path)
-        oneDrivePath := filepath.ToSlash(filepath.Join(remote, relPath))
-        return uploadFile(oneDrivePath, path, token)
+        plan.jobs = append(plan.jobs, uploadJob{remote: oneDrivePath, local: localPath, size: info.Size()})
+        plan.totalBytes += info.Size()
+        return nil
     })
+    if err != nil {
+        return nil, err
+    }
+    return plan, nil
 }
 
-func uploadFile(remote, local, token string) error {
+// uploadFolder first scans the local tree, checking every name before any
+// request is made, then creates the remote folders and notes what already
+// exists, and finally uploads the files with opts.Workers in parallel. A
+// failed file does not stop the others; failures are listed at the end.
+func (run *uploadRun) uploadFolder(ctx context.Context, remote, local string) error {
+    plan, err := run.planUpload(remote, local)
+    if err != nil {
+        return err
+    }
+
+    if len(plan.collisions) > 0 {
+        fmt.Println("❌ These paths would overwrite each other on OneDrive, which ignores case:")
+        for _, c := range plan.collisions {
+            fmt.Println("  " + c)
+        }
+        fmt.Println("Rename them, or pass --on-collision rename|skip.")
+        return fmt.Errorf("%d name collision(s), nothing was uploaded", len(plan.collisions))
+    }
+    if len(plan.problems) > 0 {
+        fmt.Println("❌ These names cannot be stored on OneDrive:")
+        for _, p := range plan.problems {
+            fmt.Println("  " + p)
+        }
+        if !run.opts.Sanitize {
+            fmt.Println("Rename them, exclude them, or pass --sanitize to substitute lookalike characters.")
+        }
+        return fmt.Errorf("%d invalid path(s), nothing was uploaded", len(plan.problems))
+    }
+    if len(plan.renames) > 0 {
+        for sanitized, original := range plan.renames {
+            fmt.Printf("✏️ Sanitized: %s -> %s\n", original, sanitized)
+        }
+        if err := recordSanitized(plan.renames); err != nil {
+            return err
+        }
+        fmt.Println("📝 Name mapping saved to", SanitizeMapFile)
+    }
+
+    // Remote children of each folder, keyed by collisionKey since OneDrive
+    // names are case-insensitive. One listing per folder is much cheaper
+    // than a lookup per file.
+    existing := map[string]map[string]DriveItem{}
+    for _, dir := range plan.dirs {
+        // Create folders up front so empty directories exist remotely too.
+        if _, err := ensureFolder(ctx, dir); err != nil {
+            return err
+        }
+        children, err := listChildren(ctx, dir)
+        if err != nil {
+            return err
+        }
+        byName := map[string]DriveItem{}
+        for _, child := range children {
+            byName[collisionKey(child.Name)] = child
+        }
+        existing[dir] = byName
+    }
+    for i := range plan.jobs {
+        dir, name := path.Split(plan.jobs[i].remote)
+        if child, ok := existing[path.Clean(dir)][collisionKey(name)]; ok {
+            plan.jobs[i].existing = &child
+        }
+    }
+
+    workers := run.opts.Workers
+    if workers < 1 {
+        workers = 1
+    }
+    if plan.excluded > 0 {
+        fmt.Printf("🚫 Excluded %d paths by filter\n", plan.excluded)
+    }
+    fmt.Printf("📦 Uploading %d files (%d MB) with %d workers\n", len(plan.jobs), plan.totalBytes/1024/1024, workers)
+    run.progress = startProgress(plan.totalBytes, int64(len(plan.jobs)))
+    run.planned = len(plan.jobs)
+
+    queue := make(chan uploadJob)
+    var mu sync.Mutex
+    var failures []string
+    var wg sync.WaitGroup
+    for w := 0; w < workers; w++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for job := range queue {
+                err := run.uploadFile(ctx, job.remote, job.local, job.existing)
+                if err != nil && ctx.Err() != nil {
+                    // Interrupted, not failed; the caller reports it.
+                    continue
+                }
+                if err != nil {
+                    printLine("❌ %s: %v", job.remote, err)
+                    mu.Lock()
+                    failures = append(failures, fmt.Sprintf("%s: %v", job.remote, err))
+                    mu.Unlock()
+                }
+                run.progress.fileDone()
+            }
+        }()
+    }
+feed:
+    for _, job := range plan.jobs {
+        select {
+        case queue <- job:
+        case <-ctx.Done():
+            break feed
+        }
+    }
+    close(queue)
+    wg.Wait()
+    run.progress.stop()
+
+    if len(failures) > 0 {
+        sort.Strings(failures)
+        fmt.Println("\n❌ Failed uploads:")
+        for _, f := range failures {
+            fmt.Println("  " + f)
+        }
+        return fmt.Errorf("%d of %d files failed to upload", len(failures), len(plan.jobs))
+    }
+    return nil
+}
+
+// uploadFile uploads one file. existing is what is currently at remote, if
+// anything, and drives the conflict policy.
+func (run *uploadRun) uploadFile(ctx context.Context, remote, local string, existing *DriveItem) error {
+    remote = "/" + strings.TrimLeft(remote, "/")
     file, err := os.Open(local)
     if err != nil {
         return err
@@ -63,98 +457,517 @@ func uploadFile(remote, local, token string) error {
     info, _ := file.Stat()
     size := info.Size()
 
-    // Create upload session
-    sessionURL := fmt.Sprintf("https://graph.microsoft.com/v1.0/me/drive/root:%s:/createUploadSession",
-        escapePath("/" + strings.TrimLeft(remote, "/")))
-    reqBody := map[string]interface{}{
-        "item": map[string]string{"@microsoft.graph.conflictBehavior": "replace"},
+    reason, err := run.opts.skipReason(local, info, existing)
+    if err != nil {
+        return err
+    }
+    if reason != "" {
+        run.report.add(&run.report.Skipped, fmt.Sprintf("%s (%s)", remote, reason))
+        run.progress.addBytes(size)
+        return nil
+    }
+    if existing != nil && run.opts.OnConflict == "fail" {
+        return fmt.Errorf("%s already exists", remote)
     }
-    jsonBody, _ := json.Marshal(reqBody)
 
-    req, _ := http.NewRequest("POST", sessionURL, bytes.NewReader(jsonBody))
-    req.Header.Set("Authorization", "Bearer "+token)
-    req.Header.Set("Content-Type", "application/json")
+    conflict := run.opts.graphConflict()
+    for attempt := 1; ; attempt++ {
+        item, sent, err := run.sendFile(ctx, remote, local, file, info, conflict)
+        if err != nil {
+            return err
+        }
+        err = verifyUpload(ctx, local, size, item, run.opts.Verify)
+        if err == nil {
+            printLine("✅ %s", remote)
+            run.recordUpload(remote, existing, item)
+            return nil
+        }
+        if !isMismatch(err) || attempt == maxVerifyAttempts {
+            return fmt.Errorf("%s: %w", remote, err)
+        }
+        printLine("⚠️ %s: %v, uploading again", remote, err)
+        run.progress.addBytes(-sent)
 
-    resp, err := http.DefaultClient.Do(req)
+        // Overwrite the bad copy, wherever the conflict policy put it.
+        remote = path.Join(path.Dir(remote), item.Name)
+        conflict = "replace"
+    }
+}
+
+// sendFile transfers one file, continuing a saved session if there is one.
+// sent is how much was uploaded by this call.
+func (run *uploadRun) sendFile(ctx context.Context, remote, local string, file *os.File, info os.FileInfo, conflict string) (*DriveItem, int64, error) {
+    size := info.Size()
+    if size < simpleUploadLimit {
+        item, err := uploadSmallFile(ctx, remote, file, size, conflict)
+        if err != nil {
+            return nil, 0, err
+        }
+        if times := run.fileTimes(info); times != nil {
+            // A simple PUT cannot carry metadata, so set the times afterwards.
+            if err := graphJSON(ctx, "PATCH", itemIDURL(*item), map[string]interface{}{"fileSystemInfo": times}, item); err != nil {
+                return nil, 0, fmt.Errorf("setting timestamps on %s: %w", remote, err)
+            }
+        }
+        run.progress.addBytes(size)
+        return item, size, nil
+    }
+
+    session, offset, resumed := resumeSession(ctx, remote, local, info)
+    if resumed {
+        printLine("♻️ Resuming %s at %d/%d MB", remote, offset/1024/1024, size/1024/1024)
+    } else {
+        created, err := createUploadSession(ctx, remote, conflict, run.fileTimes(info))
+        if err != nil {
+            return nil, 0, err
+        }
+        abs, _ := filepath.Abs(local)
+        session = uploadSession{
+            UploadURL:          created.UploadURL,
+            ExpirationDateTime: created.ExpirationDateTime,
+            Remote:             remote,
+            Local:              abs,
+            Size:               size,
+            ModTime:            info.ModTime(),
+        }
+        rememberSession(session)
+    }
+
+    printLine("🚀 Uploading %s -> %s", local, remote)
+    item, err := uploadChunks(ctx, file, size, session.UploadURL, offset, run.progress)
     if err != nil {
+        if ctx.Err() != nil {
+            run.abandonSession(remote, session.UploadURL)
+        }
+        if isNotFound(err) {
+            // The session expired or was cancelled; start over next time.
+            forgetSession(remote)
+        }
+        return nil, 0, err
+    }
+    forgetSession(remote)
+    if item == nil {
+        if item, err = committedItem(ctx, remote, conflict); err != nil {
+            return nil, 0, err
+        }
+    }
+    return item, size - offset, nil
+}
+
+// abandonSession applies --on-interrupt to the session of an upload that was
+// interrupted.
+func (run *uploadRun) abandonSession(remote, uploadURL string) {
+    if run.opts.OnInterrupt == "keep" {
+        printLine("⏸️ %s paused; continue with: onedrivecli upload --resume", remote)
+        return
+    }
+    ctx, cancel := cleanupContext()
+    defer cancel()
+    if err := deleteSession(ctx, uploadURL); err != nil {
+        printLine("⚠️ Could not cancel the upload session for %s: %v", remote, err)
+    }
+    forgetSession(remote)
+}
+
+// fileTimes is the fileSystemInfo facet carrying a local file's timestamps,
+// or nil when they should not be preserved.
+func (run *uploadRun) fileTimes(info os.FileInfo) map[string]string {
+    if run.opts.NoTimes {
+        return nil
+    }
+    times := map[string]string{
+        "lastModifiedDateTime": info.ModTime().UTC().Format(time.RFC3339),
+    }
+    if created, ok := fileCreationTime(info); ok {
+        times["createdDateTime"] = created.UTC().Format(time.RFC3339)
+    }
+    return times
+}
+
+func (run *uploadRun) recordUpload(remote string, existing, item *DriveItem) {
+    report := &run.report
+    switch {
+    case collisionKey(item.Name) != collisionKey(path.Base(remote)):
+        // OneDrive keeps the existing name's case when replacing, which is
+        // not a rename.
+        report.add(&report.Renamed, fmt.Sprintf("%s -> %s", remote, path.Join(path.Dir(remote), item.Name)))
+    case existing != nil:
+        report.add(&report.Replaced, remote)
+    default:
+        report.add(&report.Uploaded, remote)
+    }
+}
+
+// sameContent compares a local file with a remote item by size and then by
+// the strongest hash the drive reports. quickXorHash is always available, so
+// business drives are compared by content too. Without any hash the
+// modified times must also match, as uploads preserve them.
+func sameContent(local string, info os.FileInfo, item *DriveItem) (bool, error) {
+    if info.Size() != item.Size {
+        return false, nil
+    }
+    for _, algo := range []string{"sha256", "sha1", "quickxor"} {
+        want := remoteHash(*item, algo)
+        if want == "" {
+            continue
+        }
+        got, err := hashLocalFile(local, algo)
+        if err != nil {
+            return false, err
+        }
+        return sameHash(algo, got, want), nil
+    }
+    return info.ModTime().Truncate(time.Second).Equal(item.modTime()), nil
+}
+
+// uploadSmallFile sends the whole file in a single PUT to /content, which
+// saves the session round-trips for files under simpleUploadLimit.
+func uploadSmallFile(ctx context.Context, remote string, file io.ReaderAt, size int64, conflict string) (*DriveItem, error) {
+    var item *DriveItem
+    err := retryTransient(ctx, remote, func() error {
+        var err error
+        item, err = putSmallFile(ctx, remote, file, size, conflict)
         return err
+    })
+    return item, err
+}
+
+func putSmallFile(ctx context.Context, remote string, file io.ReaderAt, size int64, conflict string) (*DriveItem, error) {
+    endpoint := itemURL(remote) + "/content?@microsoft.graph.conflictBehavior=" + url.QueryEscape(conflict)
+    resp, err := sendAuthorized(func(token string) (*http.Response, error) {
+        body := throttle(io.NewSectionReader(file, 0, size))
+        if size == 0 {
+            body = http.NoBody
+        }
+        req, err := http.NewRequestWithContext(ctx, "PUT", endpoint, body)
+        if err != nil {
+            return nil, err
+        }
+        req.ContentLength = size
+        req.Header.Set("Authorization", "Bearer "+token)
+        req.Header.Set("Content-Type", "application/octet-stream")
+        return http.DefaultClient.Do(req)
+    })
+    if err != nil {
+        return nil, err
     }
     defer resp.Body.Close()
 
-    var session struct {
-        UploadURL string `json:"uploadUrl"`
+    if resp.StatusCode >= 300 {
+        return nil, readGraphError(resp)
+    }
+    var item DriveItem
+    if err := json.NewDecoder(resp.Body).Decode(&item); err != nil {
+        return nil, fmt.Errorf("decoding uploaded item: %w", err)
+    }
+    if item.ID == "" {
+        return nil, fmt.Errorf("upload did not return the uploaded item")
+    }
+    return &item, nil
+}
+
+// createUploadSession starts a resumable upload. times, if not nil, is sent
+// as the item's fileSystemInfo.
+func createUploadSession(ctx context.Context, remote, conflict string, times map[string]string) (*uploadSession, error) {
+    sessionURL := fmt.Sprintf("https://graph.microsoft.com/v1.0/me/drive/root:%s:/createUploadSession",
+        escapePath("/" + strings.TrimLeft(remote, "/")))
+    item := map[string]interface{}{"@microsoft.graph.conflictBehavior": conflict}
+    if times != nil {
+        item["fileSystemInfo"] = times
+    }
+    reqBody := map[string]interface{}{"item": item}
+
+    var session uploadSession
+    err := retryTransient(ctx, remote, func() error {
+        return graphJSON(ctx, "POST", sessionURL, reqBody, &session)
+    })
+    if err != nil {
+        return nil, err
     }
-    json.NewDecoder(resp.Body).Decode(&session)
     if session.UploadURL == "" {
-        return fmt.Errorf("failed to create upload session")
+        return nil, fmt.Errorf("failed to create upload session")
     }
+    return &session, nil
+}
 
-    fmt.Printf("🚀 Uploading %s -> %s\n", local, remote)
-    return uploadChunks(file, size, session.UploadURL)
+// retryTransient calls fn until it succeeds, fails for good or has been
+// tried maxChunkAttempts times, backing off as sendChunk does.
+func retryTransient(ctx context.Context, remote string, fn func() error) error {
+    for attempt := 1; ; attempt++ {
+        err := fn()
+        if err == nil || attempt >= maxChunkAttempts || !isRetryable(err) {
+            return err
+        }
+        printLine("⚠️ %s failed (%v), retrying...", remote, err)
+        if err := sleepContext(ctx, time.Duration(attempt*attempt)*time.Second); err != nil {
+            return err
+        }
+    }
 }
 
-func uploadChunks(file *os.File, fileSize int64, uploadURL string) error {
-    totalChunks := int((fileSize + chunkSize - 1) / chunkSize)
-    var uploaded int64
-    start := time.Now()
-    jobs := make(chan int, totalChunks)
-    var wg sync.WaitGroup
+// uploadStream uploads from a reader of unknown length, such as a pipe. We
+// read one chunk ahead so that only the final chunk's Content-Range carries
+// the total size; earlier chunks send "*".
+func (run *uploadRun) uploadStream(ctx context.Context, remote string, r io.Reader) error {
+    existing, err := lookupExisting(ctx, remote)
+    if err != nil {
+        return err
+    }
+    if existing != nil {
+        switch run.opts.OnConflict {
+        case "skip":
+            run.report.add(&run.report.Skipped, remote+" (already exists)")
+            return nil
+        case "fail":
+            return fmt.Errorf("%s already exists", remote)
+        }
+    }
 
-    for w := 0; w < workers; w++ {
-        wg.Add(1)
-        go func() {
-            defer wg.Done()
-            for idx := range jobs {
-                startByte := int64(idx) * chunkSize
-                endByte := startByte + chunkSize - 1
-                if endByte >= fileSize {
-                    endByte = fileSize - 1
-                }
-                size := endByte - startByte + 1
-                buffer := make([]byte, size)
-                file.ReadAt(buffer, startByte)
+    buf := make([]byte, chunkSize)
+    next := make([]byte, chunkSize)
+    h := newQuickXorHash()
 
-                req, _ := http.NewRequest("PUT", uploadURL, bytes.NewReader(buffer))
-                req.Header.Set("Content-Length", fmt.Sprint(size))
-                req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", startByte, endByte, fileSize))
+    n, readErr := io.ReadFull(r, buf)
+    if readErr == io.EOF || (readErr == io.ErrUnexpectedEOF && n < simpleUploadLimit) {
+        // The whole stream fit in the first read; no session needed.
+        item, err := uploadSmallFile(ctx, remote, bytes.NewReader(buf[:n]), int64(n), run.opts.graphConflict())
+        if err != nil {
+            return err
+        }
+        run.progress.addBytes(int64(n))
+        h.Write(buf[:n])
+        if err := verifyStream(ctx, item, int64(n), h, run.opts.Verify); err != nil {
+            return fmt.Errorf("%s: %w", remote, err)
+        }
+        printLine("✅ stdin -> %s", remote)
+        run.recordUpload(remote, existing, item)
+        return nil
+    }
+    if readErr != nil && readErr != io.ErrUnexpectedEOF {
+        return readErr
+    }
 
-                resp, err := http.DefaultClient.Do(req)
-                if err != nil {
-                    log.Printf("Chunk %d failed: %v\n", idx, err)
-                    continue
-                }
-                io.Copy(io.Discard, resp.Body)
-                resp.Body.Close()
+    session, err := createUploadSession(ctx, remote, run.opts.graphConflict(), nil)
+    if err != nil {
+        return err
+    }
+    uploadURL := session.UploadURL
+    // stdin cannot be replayed, so a failed session is of no further use.
+    abort := func(err error) error {
+        cctx, cancel := cleanupContext()
+        defer cancel()
+        deleteSession(cctx, uploadURL)
+        return err
+    }
+    printLine("🚀 Uploading stdin -> %s", remote)
 
-                atomic.AddInt64(&uploaded, size)
-                printProgress(uploaded, fileSize, start)
+    var offset int64
+    for {
+        if readErr != nil && readErr != io.ErrUnexpectedEOF {
+            return abort(readErr)
+        }
+        last := readErr == io.ErrUnexpectedEOF
+
+        var m int
+        var nextErr error
+        if !last {
+            m, nextErr = io.ReadFull(r, next)
+            if m == 0 && nextErr == io.EOF {
+                last = true
             }
-        }()
+        }
+
+        total := "*"
+        if last {
+            total = fmt.Sprint(offset + int64(n))
+        }
+        item, err := sendChunk(ctx, uploadURL, buf[:n], offset, total)
+        if err != nil {
+            return abort(err)
+        }
+        h.Write(buf[:n])
+        offset += int64(n)
+        run.progress.addBytes(int64(n))
+
+        if last {
+            if item == nil {
+                if item, err = committedItem(ctx, remote, run.opts.graphConflict()); err != nil {
+                    return err
+                }
+            }
+            // stdin cannot be replayed, so a mismatch is reported, not retried.
+            if err := verifyStream(ctx, item, offset, h, run.opts.Verify); err != nil {
+                return fmt.Errorf("%s: %w", remote, err)
+            }
+            printLine("✅ stdin -> %s", remote)
+            run.recordUpload(remote, existing, item)
+            return nil
+        }
+        buf, next = next, buf
+        n, readErr = m, nextErr
     }
+}
 
-    for i := 0; i < totalChunks; i++ {
-        jobs <- i
+// uploadChunks sends the file through the upload session one range at a
+// time, in order, as Graph requires, starting at offset. It returns the item
+// created by the final range, or nil if a retry found that range already
+// received and the item committed; see committedItem.
+func uploadChunks(ctx context.Context, file io.ReaderAt, fileSize int64, uploadURL string, offset int64, progress *transferProgress) (*DriveItem, error) {
+    if fileSize == 0 {
+        return nil, fmt.Errorf("upload sessions cannot send empty files")
     }
-    close(jobs)
-    wg.Wait()
 
-    fmt.Println("\n✅ Upload complete!")
-    return nil
+    progress.addBytes(offset)
+    total := fmt.Sprint(fileSize)
+    buffer := make([]byte, chunkSize)
+    for offset < fileSize {
+        end := offset + chunkSize
+        if end > fileSize {
+            end = fileSize
+        }
+        n, err := file.ReadAt(buffer[:end-offset], offset)
+        if err != nil && !(err == io.EOF && int64(n) == end-offset) {
+            return nil, err
+        }
+
+        item, err := sendChunk(ctx, uploadURL, buffer[:n], offset, total)
+        if err != nil {
+            return nil, err
+        }
+        progress.addBytes(end - offset)
+        offset = end
+
+        if offset == fileSize {
+            return item, nil
+        }
+    }
+    return nil, fmt.Errorf("upload ended early")
+}
+
+// sendChunk PUTs data at offset, retrying transient failures. After a failure
+// the session is asked which byte it expects next, which may fall inside this
+// chunk if part of it was already received. If all of it was, there is no
+// response to return the item from, and the item is nil.
+func sendChunk(ctx context.Context, uploadURL string, data []byte, offset int64, total string) (*DriveItem, error) {
+    end := offset + int64(len(data))
+    for attempt := 1; ; attempt++ {
+        item, err := putChunk(ctx, uploadURL, data, offset, total)
+        if err == nil {
+            return item, nil
+        }
+        if attempt >= maxChunkAttempts || !isRetryable(err) {
+            return nil, fmt.Errorf("chunk at offset %d: %w", offset, err)
+        }
+
+        printLine("⚠️ Chunk at offset %d failed (%v), retrying...", offset, err)
+        if err := sleepContext(ctx, time.Duration(attempt*attempt)*time.Second); err != nil {
+            return nil, err
+        }
+
+        next, qerr := nextExpectedOffset(ctx, uploadURL)
+        if qerr != nil {
+            continue
+        }
+        if next < offset || next > end {
+            return nil, fmt.Errorf("upload session expects offset %d, outside chunk %d-%d", next, offset, end-1)
+        }
+        if next == end {
+            return nil, nil
+        }
+        data = data[next-offset:]
+        offset = next
+    }
 }
 
-func printProgress(uploaded, total int64, start time.Time) {
-    percent := float64(uploaded) / float64(total) * 100
-    elapsed := time.Since(start).Seconds()
-    speed := float64(uploaded) / 1024 / 1024 / elapsed
-    eta := "-"
-    if speed > 0 {
-        eta = fmt.Sprintf("%.1fs", float64(total-uploaded)/1024/1024/speed)
+// committedItem looks up the item an upload session committed when the
+// response to its final range was lost. Under conflict "rename" the server
+// may have chosen another name, so the path cannot be trusted.
+func committedItem(ctx context.Context, remote, conflict string) (*DriveItem, error) {
+    if conflict == "rename" {
+        return nil, fmt.Errorf("upload finished, but the server did not say what it named %s", remote)
+    }
+    item, err := getItem(ctx, remote)
+    if err != nil {
+        return nil, fmt.Errorf("upload finished, but looking up %s failed: %w", remote, err)
     }
+    return item, nil
+}
+
+func putChunk(ctx context.Context, uploadURL string, data []byte, offset int64, total string) (*DriveItem, error) {
+    req, _ := http.NewRequestWithContext(ctx, "PUT", uploadURL, throttle(bytes.NewReader(data)))
+    req.ContentLength = int64(len(data))
+    req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%s", offset, offset+int64(len(data))-1, total))
 
-    fmt.Printf("\r%.2f%% | %d/%d MB | %.2f MB/s | Elapsed: %.1fs | ETA: %s",
-        percent, uploaded/1024/1024, total/1024/1024, speed, elapsed, eta)
+    resp, err := http.DefaultClient.Do(req)
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode >= 300 {
+        return nil, readGraphError(resp)
+    }
+    if resp.StatusCode == http.StatusAccepted {
+        io.Copy(io.Discard, resp.Body)
+        return nil, nil
+    }
+
+    // 200 or 201: the last range was accepted and the item was committed.
+    var item DriveItem
+    if err := json.NewDecoder(resp.Body).Decode(&item); err != nil {
+        return nil, fmt.Errorf("decoding uploaded item: %w", err)
+    }
+    return &item, nil
+}
+
+// nextExpectedOffset asks the upload session where to continue.
+func nextExpectedOffset(ctx context.Context, uploadURL string) (int64, error) {
+    req, _ := http.NewRequestWithContext(ctx, "GET", uploadURL, nil)
+    resp, err := http.DefaultClient.Do(req)
+    if err != nil {
+        return 0, err
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode >= 300 {
+        return 0, readGraphError(resp)
+    }
+    var status struct {
+        NextExpectedRanges []string `json:"nextExpectedRanges"`
+    }
+    if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+        return 0, err
+    }
+    if len(status.NextExpectedRanges) == 0 {
+        return 0, fmt.Errorf("upload session reports no pending ranges")
+    }
+
+    var next int64
+    if _, err := fmt.Sscanf(status.NextExpectedRanges[0], "%d-", &next); err != nil {
+        return 0, fmt.Errorf("unexpected range %q", status.NextExpectedRanges[0])
+    }
+    return next, nil
+}
+
+// isRetryable reports whether an upload failure is worth retrying: network
+// errors, throttling, server errors and out-of-order ranges.
+func isRetryable(err error) bool {
+    if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+        return false
+    }
+    var ge *graphError
+    if !errors.As(err, &ge) {
+        return true
+    }
+    return ge.StatusCode == http.StatusTooManyRequests ||
+        ge.StatusCode == http.StatusRequestedRangeNotSatisfiable ||
+        ge.StatusCode >= 500
 }
 
 func escapePath(path string) string {
-    return strings.ReplaceAll(path, " ", "%20")
+    parts := strings.Split(path, "/")
+    for i, p := range parts {
+        parts[i] = url.PathEscape(p)
+    }
+    return strings.Join(parts, "/")
 }
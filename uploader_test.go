@@ -0,0 +1,182 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "fmt"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "runtime"
+    "sort"
+    "testing"
+    "time"
+)
+
+func TestPlanUploadUncleanLocalPath(t *testing.T) {
+    dir := inTempDir(t)
+    for _, name := range []string{"photos/a.jpg", "photos/sub/b.jpg"} {
+        p := filepath.Join(dir, filepath.FromSlash(name))
+        if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+            t.Fatal(err)
+        }
+        if err := os.WriteFile(p, []byte("x"), 0644); err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    for _, local := range []string{"photos", "./photos", "photos/", "./photos/"} {
+        // No filter: a nil one must be safe to walk with.
+        run := &uploadRun{}
+        plan, err := run.planUpload("/Backup", local)
+        if err != nil {
+            t.Fatalf("%s: %v", local, err)
+        }
+        var got []string
+        for _, job := range plan.jobs {
+            got = append(got, job.remote)
+        }
+        sort.Strings(got)
+        want := []string{"/Backup/a.jpg", "/Backup/sub/b.jpg"}
+        if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+            t.Errorf("%s: files planned as %v, want %v", local, got, want)
+        }
+        if len(plan.dirs) != 2 || plan.dirs[0] != "/Backup" || plan.dirs[1] != "/Backup/sub" {
+            t.Errorf("%s: folders planned as %v", local, plan.dirs)
+        }
+    }
+}
+
+// The server commits the item on the final range but the response is lost;
+// the retry then finds nothing left to send.
+func TestUploadChunksFinalRangeAlreadyReceived(t *testing.T) {
+    data := bytes.Repeat([]byte("x"), 1000)
+    var received int64
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        switch r.Method {
+        case "PUT":
+            n, _ := io.Copy(io.Discard, r.Body)
+            received += n
+            w.WriteHeader(http.StatusInternalServerError)
+            fmt.Fprint(w, `{"error":{"code":"generalException","message":"lost"}}`)
+        case "GET":
+            fmt.Fprintf(w, `{"nextExpectedRanges":["%d-"]}`, received)
+        }
+    }))
+    defer srv.Close()
+
+    progress := startProgress(int64(len(data)), 1)
+    item, err := uploadChunks(context.Background(), bytes.NewReader(data), int64(len(data)), srv.URL, 0, progress)
+    progress.stop()
+    if err != nil {
+        t.Fatalf("uploadChunks: %v", err)
+    }
+    if item != nil {
+        t.Errorf("uploadChunks returned %+v, want nil for committedItem to look up", item)
+    }
+}
+
+func TestSameContent(t *testing.T) {
+    local := filepath.Join(t.TempDir(), "a.txt")
+    if err := os.WriteFile(local, []byte("abc"), 0644); err != nil {
+        t.Fatal(err)
+    }
+    mtime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+    os.Chtimes(local, mtime, mtime)
+    info, _ := os.Stat(local)
+
+    hashed := func(quickXor string) *DriveItem {
+        return &DriveItem{
+            Size:                 3,
+            File:                 &FileFacet{Hashes: &Hashes{QuickXorHash: quickXor}},
+            LastModifiedDateTime: mtime.Add(-time.Hour),
+        }
+    }
+    tests := []struct {
+        name string
+        item *DriveItem
+        want bool
+    }{
+        {"same hash", hashed("YRDDGAAAAAAAAAAAAwAAAAAAAAA="), true},
+        {"other hash", hashed("YRDDGAAAAAAAAAAAAwAAAAAAAAB="), false},
+        {"other size", &DriveItem{Size: 4, File: &FileFacet{}, LastModifiedDateTime: mtime}, false},
+        {"no hash, same time", &DriveItem{Size: 3, File: &FileFacet{}, LastModifiedDateTime: mtime}, true},
+        {"no hash, other time", &DriveItem{Size: 3, File: &FileFacet{}, LastModifiedDateTime: mtime.Add(time.Minute)}, false},
+    }
+    for _, tt := range tests {
+        got, err := sameContent(local, info, tt.item)
+        if err != nil {
+            t.Fatalf("%s: %v", tt.name, err)
+        }
+        if got != tt.want {
+            t.Errorf("%s: sameContent = %v, want %v", tt.name, got, tt.want)
+        }
+    }
+}
+
+func TestRecordUpload(t *testing.T) {
+    run := &uploadRun{}
+    existing := &DriveItem{Name: "Report.PDF"}
+    run.recordUpload("/docs/report.pdf", existing, &DriveItem{Name: "Report.PDF"})
+    run.recordUpload("/docs/new.txt", nil, &DriveItem{Name: "new.txt"})
+    run.recordUpload("/docs/a.txt", existing, &DriveItem{Name: "a 1.txt"})
+
+    r := &run.report
+    if len(r.Replaced) != 1 || r.Replaced[0] != "/docs/report.pdf" {
+        t.Errorf("Replaced = %v", r.Replaced)
+    }
+    if len(r.Uploaded) != 1 || r.Uploaded[0] != "/docs/new.txt" {
+        t.Errorf("Uploaded = %v", r.Uploaded)
+    }
+    if len(r.Renamed) != 1 || r.Renamed[0] != "/docs/a.txt -> /docs/a 1.txt" {
+        t.Errorf("Renamed = %v", r.Renamed)
+    }
+}
+
+func TestRetryTransient(t *testing.T) {
+    calls := 0
+    err := retryTransient(context.Background(), "/a.txt", func() error {
+        calls++
+        if calls == 1 {
+            return &graphError{StatusCode: http.StatusTooManyRequests}
+        }
+        return nil
+    })
+    if err != nil || calls != 2 {
+        t.Errorf("throttled call: err %v after %d calls, want success after 2", err, calls)
+    }
+
+    calls = 0
+    err = retryTransient(context.Background(), "/a.txt", func() error {
+        calls++
+        return &graphError{StatusCode: http.StatusForbidden}
+    })
+    if err == nil || calls != 1 {
+        t.Errorf("forbidden call: err %v after %d calls, want failure after 1", err, calls)
+    }
+}
+
+// A sanitized name that then collides is recorded under the name it was
+// finally given.
+func TestPlanUploadSanitizedRename(t *testing.T) {
+    if runtime.GOOS == "windows" {
+        t.Skip("Windows does not allow \":\" in file names")
+    }
+    dir := t.TempDir()
+    for _, name := range []string{"A：b.txt", "a:b.txt"} {
+        if err := os.WriteFile(filepath.Join(dir, name), []byte("x"), 0644); err != nil {
+            t.Fatal(err)
+        }
+    }
+    run := &uploadRun{opts: uploadOptions{Sanitize: true, OnCollision: "rename"}}
+    plan, err := run.planUpload("/Backup", dir)
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := map[string]string{"/Backup/a：b (2).txt": filepath.Join(dir, "a:b.txt")}
+    if fmt.Sprint(plan.renames) != fmt.Sprint(want) {
+        t.Errorf("renames = %v, want %v", plan.renames, want)
+    }
+}
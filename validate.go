@@ -0,0 +1,139 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "path"
+    "strings"
+)
+
+// SanitizeMapFile is absolute so that every upload adds to the same mapping,
+// whichever directory it runs from.
+var SanitizeMapFile = statePath("sanitized_names.json")
+
+// OneDrive rejects paths longer than this, counted on the decoded path.
+const maxRemotePathLength = 400
+
+// lookalikes maps each character OneDrive forbids to a full-width Unicode
+// lookalike. The mapping is one-to-one, so sanitized names can be reversed.
+var lookalikes = map[rune]rune{
+    '"':  '＂',
+    '*':  '＊',
+    ':':  '：',
+    '<':  '＜',
+    '>':  '＞',
+    '?':  '？',
+    '\\': '＼',
+    '|':  '｜',
+}
+
+var reservedNames = map[string]bool{
+    "CON": true, "PRN": true, "AUX": true, "NUL": true,
+    ".LOCK": true, "DESKTOP.INI": true,
+}
+
+func init() {
+    for i := 0; i <= 9; i++ {
+        reservedNames[fmt.Sprintf("COM%d", i)] = true
+        reservedNames[fmt.Sprintf("LPT%d", i)] = true
+    }
+}
+
+// nameProblem explains why OneDrive would reject name, or returns "".
+func nameProblem(name string) string {
+    if i := strings.IndexAny(name, `"*:<>?\|`); i >= 0 {
+        return fmt.Sprintf("contains %q", name[i])
+    }
+    if strings.HasSuffix(name, ".") {
+        return "ends with a dot"
+    }
+    if strings.TrimSpace(name) != name {
+        return "starts or ends with a space"
+    }
+    if reservedNames[strings.ToUpper(name)] {
+        return "is a reserved name"
+    }
+    if strings.HasPrefix(name, "~$") {
+        return `starts with "~$"`
+    }
+    if strings.Contains(strings.ToLower(name), "_vti_") {
+        return `contains "_vti_"`
+    }
+    return ""
+}
+
+// sanitizeName rewrites an invalid name with lookalike characters. Valid
+// names are returned unchanged.
+func sanitizeName(name string) string {
+    if nameProblem(name) == "" {
+        return name
+    }
+
+    var b strings.Builder
+    for _, r := range name {
+        if alt, ok := lookalikes[r]; ok {
+            r = alt
+        }
+        b.WriteRune(r)
+    }
+    name = b.String()
+
+    // Edge spaces become OPEN BOX, trailing dots FULLWIDTH FULL STOP.
+    trimmed := strings.TrimLeft(name, " ")
+    name = strings.Repeat("␣", len(name)-len(trimmed)) + trimmed
+    trimmed = strings.TrimRight(name, " ")
+    name = trimmed + strings.Repeat("␣", len(name)-len(trimmed))
+    trimmed = strings.TrimRight(name, ".")
+    name = trimmed + strings.Repeat("．", len(name)-len(trimmed))
+
+    if reservedNames[strings.ToUpper(name)] {
+        // Swap the first character for its full-width form: "CON" -> "ＣON".
+        r := []rune(name)
+        if r[0] >= '!' && r[0] <= '~' {
+            r[0] += 0xFEE0
+        }
+        name = string(r)
+    }
+    if strings.HasPrefix(name, "~$") {
+        name = "～" + strings.TrimPrefix(name, "~")
+    }
+    if i := strings.Index(strings.ToLower(name), "_vti_"); i >= 0 {
+        name = name[:i+4] + "＿" + name[i+5:]
+    }
+    return name
+}
+
+// remotePathProblem checks a full remote path, including its length.
+func remotePathProblem(remote string) string {
+    if n := len([]rune(remote)); n > maxRemotePathLength {
+        return fmt.Sprintf("path is %d characters, over the %d limit", n, maxRemotePathLength)
+    }
+    if problem := nameProblem(path.Base(remote)); problem != "" {
+        return problem
+    }
+    return ""
+}
+
+// recordSanitized adds the renames, keyed by sanitized remote path with the
+// original local path as value, to SanitizeMapFile so they can be undone
+// later.
+func recordSanitized(renames map[string]string) error {
+    if len(renames) == 0 {
+        return nil
+    }
+    mapping := map[string]string{}
+    if data, err := os.ReadFile(SanitizeMapFile); err == nil {
+        if err := json.Unmarshal(data, &mapping); err != nil {
+            return fmt.Errorf("%s: %w", SanitizeMapFile, err)
+        }
+    }
+    for sanitized, original := range renames {
+        mapping[sanitized] = original
+    }
+    data, err := json.MarshalIndent(mapping, "", "  ")
+    if err != nil {
+        return err
+    }
+    return writeState(SanitizeMapFile, data, 0644)
+}
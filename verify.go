@@ -0,0 +1,108 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "hash"
+)
+
+// A transfer whose result does not match its source is attempted this many
+// times in total before giving up.
+const maxVerifyAttempts = 3
+
+// mismatchError reports a transfer that completed but whose result differs
+// from the source. These are worth retrying; other errors usually are not.
+type mismatchError struct {
+    what string
+}
+
+func (e *mismatchError) Error() string {
+    return "verification failed: " + e.what
+}
+
+func isMismatch(err error) bool {
+    var m *mismatchError
+    return errors.As(err, &m)
+}
+
+func validVerify(mode string) error {
+    switch mode {
+    case "off", "size", "hash":
+        return nil
+    }
+    return fmt.Errorf("invalid --verify %q (want off, size or hash)", mode)
+}
+
+// verifyAlgorithm picks the hash to verify item with: quickXorHash, which
+// every drive reports, else SHA-1 or SHA-256. "" means only the size can be
+// checked.
+func verifyAlgorithm(item DriveItem) string {
+    for _, algo := range []string{"quickxor", "sha1", "sha256"} {
+        if remoteHash(item, algo) != "" {
+            return algo
+        }
+    }
+    return ""
+}
+
+// checkTransfer compares what was transferred, size bytes hashing to sum
+// under algo, against the remote item.
+func checkTransfer(item DriveItem, size int64, algo, sum, mode string) error {
+    if mode == "off" {
+        return nil
+    }
+    if size != item.Size {
+        return &mismatchError{fmt.Sprintf("%d bytes transferred, expected %d", size, item.Size)}
+    }
+    if mode == "hash" && algo != "" {
+        if want := remoteHash(item, algo); !sameHash(algo, sum, want) {
+            return &mismatchError{fmt.Sprintf("%s hash is %s, expected %s", algo, sum, want)}
+        }
+    }
+    return nil
+}
+
+// verifyUpload checks an uploaded item against the local file it came from.
+func verifyUpload(ctx context.Context, local string, size int64, item *DriveItem, mode string) error {
+    if mode == "off" {
+        return nil
+    }
+    algo, sum := "", ""
+    if mode == "hash" {
+        if verifyAlgorithm(*item) == "" {
+            refreshHashes(ctx, item)
+        }
+        if algo = verifyAlgorithm(*item); algo != "" {
+            var err error
+            if sum, err = hashLocalFile(local, algo); err != nil {
+                return err
+            }
+        }
+    }
+    return checkTransfer(*item, size, algo, sum, mode)
+}
+
+// verifyStream checks an item uploaded from a stream, which cannot be read
+// again, against the size and quickXorHash computed while sending it.
+func verifyStream(ctx context.Context, item *DriveItem, size int64, h hash.Hash, mode string) error {
+    algo, sum := "", ""
+    if mode == "hash" {
+        if remoteHash(*item, "quickxor") == "" {
+            refreshHashes(ctx, item)
+        }
+        if remoteHash(*item, "quickxor") != "" {
+            algo, sum = "quickxor", encodeHash("quickxor", h.Sum(nil))
+        }
+    }
+    return checkTransfer(*item, size, algo, sum, mode)
+}
+
+// refreshHashes fetches item again. Hashes can lag behind the upload
+// response, so this gives the service one more chance to report them.
+func refreshHashes(ctx context.Context, item *DriveItem) {
+    var fresh DriveItem
+    if err := graphJSON(ctx, "GET", itemIDURL(*item), nil, &fresh); err == nil {
+        *item = fresh
+    }
+}